@@ -17,6 +17,7 @@ func DialWithToken(host, token string) (*grpc.ClientConn, error) {
 		host,
 		grpc.WithPerRPCCredentials(creds),
 		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(UnaryClientRequestId),
 	)
 }
 
@@ -3,9 +3,12 @@ package grpc
 import (
 	"net"
 
+	"git.lcgc.work/platform/kelp/listener"
+	"git.lcgc.work/platform/kelp/requestid"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/reflection"
 	"time"
 )
@@ -14,13 +17,19 @@ func New(interceptors ...grpc.UnaryServerInterceptor) *grpc.Server {
 	return grpc.NewServer(grpc.UnaryInterceptor(UnaryInterceptorChain(interceptors...)))
 }
 
+// Run serves on host, which can be any address supported by listener.Listen,
+// such as "127.0.0.1:9999", "unix:///path/to/app.sock" or "systemd://".
 func Run(gServer *grpc.Server, host string) {
-	reflection.Register(gServer)
-	lis, err := net.Listen("tcp", host)
+	lis, err := listener.Listen(host)
 	if err != nil {
 		panic(err)
 	}
-	log.Debug("grpc service listen on", host)
+	RunListener(gServer, lis)
+}
+
+func RunListener(gServer *grpc.Server, lis net.Listener) {
+	reflection.Register(gServer)
+	log.Debug("grpc service listen on", lis.Addr())
 	if err := gServer.Serve(lis); err != nil {
 		panic(err)
 	}
@@ -53,6 +62,8 @@ func Recovery(c context.Context, param interface{}, info *grpc.UnaryServerInfo,
 	return handler(c, param)
 }
 
+// Logger logs the client ip, and is prefixed with the request id by requestid.Prefix,
+// it should be after RequestId in the chain, or there is no request id.
 func Logger(c context.Context, param interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 	start := time.Now()
 
@@ -62,8 +73,15 @@ func Logger(c context.Context, param interface{}, info *grpc.UnaryServerInfo, ha
 	method := info.FullMethod
 
 	latency := end.Sub(start)
-	log.Info(
-		"-", // remote ip
+	ip := "-"
+	if p, ok := peer.FromContext(c); ok {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+	log.Info(requestid.Prefix(c,
+		ip, // remote ip
 		end.Format("2006/01/02 15:04:05"),
 		latency.Nanoseconds(),
 		method,
@@ -71,6 +89,6 @@ func Logger(c context.Context, param interface{}, info *grpc.UnaryServerInfo, ha
 		"-", // uuid
 		param,
 		resp,
-	)
+	)...)
 	return
 }
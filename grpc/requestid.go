@@ -0,0 +1,31 @@
+package grpc
+
+import (
+	"git.lcgc.work/platform/kelp/requestid"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestId reads the request id from metadata or generates one,
+// handlers get it by requestid.FromContext, and it is sent back in the header.
+func RequestId(c context.Context, param interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(c); ok && len(md[requestid.MetadataKey]) > 0 {
+		id = md[requestid.MetadataKey][0]
+	}
+	if !requestid.Valid(id) {
+		id = requestid.New()
+	}
+	grpc.SetHeader(c, metadata.Pairs(requestid.MetadataKey, id))
+	return handler(requestid.NewContext(c, id), param)
+}
+
+// UnaryClientRequestId sends the request id in ctx as metadata,
+// it is used by DialWithToken and can be used with grpc.WithUnaryInterceptor.
+func UnaryClientRequestId(c context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if id := requestid.FromContext(c); id != "" {
+		c = metadata.AppendToOutgoingContext(c, requestid.MetadataKey, id)
+	}
+	return invoker(c, method, req, reply, cc, opts...)
+}
@@ -0,0 +1,133 @@
+package listener
+
+// listener模块根据地址创建net.Listener，web和grpc服务都可以使用
+//
+// 支持的地址格式:
+//	host:port 或 tcp://host:port
+//	unix:///path/to/app.sock 或 unix:///path/to/app.sock?mode=0660
+//	fd://3                 继承的文件描述符
+//	systemd:// 或 systemd://name   systemd socket activation (LISTEN_FDS)
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// systemd passes listeners from fd 3
+	_LISTEN_FDS_START = 3
+
+	_DEFAULT_SOCKET_MODE os.FileMode = 0666
+)
+
+// Listen creates a listener by address, see package comment
+func Listen(address string) (net.Listener, error) {
+	if !strings.Contains(address, "://") {
+		return net.Listen("tcp", address)
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6":
+		return net.Listen(u.Scheme, u.Host)
+	case "unix":
+		mode := _DEFAULT_SOCKET_MODE
+		if m := u.Query().Get("mode"); m != "" {
+			n, err := strconv.ParseUint(m, 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid socket mode %s: %v", m, err)
+			}
+			mode = os.FileMode(n)
+		}
+		return ListenUnix(u.Host+u.Path, mode)
+	case "fd":
+		fd, err := strconv.Atoi(u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fd %s: %v", u.Host, err)
+		}
+		return FileListener(uintptr(fd), address)
+	case "systemd":
+		return SystemdListener(u.Host)
+	}
+	return nil, fmt.Errorf("unsupported listen address %s", address)
+}
+
+// ListenUnix listens on a unix socket file with mode,
+// a stale socket file left by a dead process is removed first.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// FileListener creates a listener from an inherited file descriptor
+func FileListener(fd uintptr, name string) (net.Listener, error) {
+	file := os.NewFile(fd, name)
+	if file == nil {
+		return nil, fmt.Errorf("invalid fd %d", fd)
+	}
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// SystemdListener returns the listener passed by systemd socket activation,
+// name is one of LISTEN_FDNAMES, empty name means the first one.
+func SystemdListener(name string) (net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, errors.New("no listener passed by systemd")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, errors.New("no listener passed by systemd")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n; i++ {
+		fdName := ""
+		if i < len(names) {
+			fdName = names[i]
+		}
+		if name == "" || name == fdName {
+			return FileListener(uintptr(_LISTEN_FDS_START+i), "systemd:"+fdName)
+		}
+	}
+	return nil, fmt.Errorf("listener %s not passed by systemd", name)
+}
@@ -0,0 +1,83 @@
+package listener
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kelp-listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.sock")
+
+	ln, err := Listen("unix://" + path + "?mode=0660")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0660 {
+		t.Error("socket mode", info.Mode().Perm())
+	}
+	if _, err := Listen("unix://" + path); err == nil {
+		t.Error("socket in use should not be removed")
+	}
+	ln.Close()
+
+	// leave a stale socket file like a killed process
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("stale socket should exist", err)
+	}
+	ln, err = Listen("unix://" + path)
+	if err != nil {
+		t.Fatal("stale socket should be removed", err)
+	}
+	ln.Close()
+
+	file := filepath.Join(dir, "file")
+	ioutil.WriteFile(file, []byte{}, 0600)
+	if _, err := Listen("unix://" + file); err == nil {
+		t.Error("regular file should not be removed")
+	}
+}
+
+func TestListenFd(t *testing.T) {
+	ln, err := Listen("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	file, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	inherited, err := FileListener(file.Fd(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inherited.Close()
+	if inherited.Addr().String() != ln.Addr().String() {
+		t.Error(inherited.Addr(), ln.Addr())
+	}
+	if _, err := SystemdListener(""); err == nil {
+		t.Error("no systemd listener should be passed")
+	}
+	if _, err := Listen("udp://127.0.0.1:0"); err == nil {
+		t.Error("udp is not supported")
+	}
+}
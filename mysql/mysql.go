@@ -2,9 +2,11 @@ package mysql
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"git.lcgc.work/platform/kelp/requestid"
 	_ "github.com/go-sql-driver/mysql"
 	"math/rand"
 	"reflect"
@@ -21,11 +23,13 @@ var (
 type DB struct {
 	name string
 	conn *sql.DB
+	ctx  context.Context
 }
 
 type TX struct {
 	name string
 	conn *sql.Tx
+	ctx  context.Context
 }
 
 func AddDB(name, dsn string, maxOpen, maxIdle int) error {
@@ -36,89 +40,97 @@ func AddDB(name, dsn string, maxOpen, maxIdle int) error {
 	if err := conn.Ping(); err != nil {
 		return err
 	}
-	pool.pool[name] = &DB{name: name, conn: conn}
+	pool.pool[name] = &DB{name: name, conn: conn, ctx: context.Background()}
 	return nil
 }
 
 func (this *DB) begin() (*sql.Tx, error) {
-	conn, err := this.conn.Begin()
+	conn, err := this.conn.BeginTx(this.ctx, nil)
 	if err != nil {
 		// retry once on error
 		log.Debug("retry begin on", err)
-		return this.conn.Begin()
+		return this.conn.BeginTx(this.ctx, nil)
 	}
 	return conn, nil
 }
 
 func (this *DB) prepare(query string) (*sql.Stmt, error) {
-	stmt, err := this.conn.Prepare(query)
+	stmt, err := this.conn.PrepareContext(this.ctx, query)
 	if err != nil {
 		// retry once on error
 		log.Debug("retry prepare on", err)
-		return this.conn.Prepare(query)
+		return this.conn.PrepareContext(this.ctx, query)
 	}
 	return stmt, nil
 }
 
 func (this *DB) exec(query string, args ...interface{}) (sql.Result, error) {
-	ret, err := this.conn.Exec(query, args...)
+	ret, err := this.conn.ExecContext(this.ctx, query, args...)
 	if err != nil {
 		// retry once on error
 		log.Debug("retry exec on", err)
-		return this.conn.Exec(query, args...)
+		return this.conn.ExecContext(this.ctx, query, args...)
 	}
 	return ret, nil
 }
 
 func (this *TX) prepare(query string) (*sql.Stmt, error) {
-	stmt, err := this.conn.Prepare(query)
+	stmt, err := this.conn.PrepareContext(this.ctx, query)
 	if err != nil {
 		// retry once on error
 		log.Debug("retry prepare on", err)
-		return this.conn.Prepare(query)
+		return this.conn.PrepareContext(this.ctx, query)
 	}
 	return stmt, nil
 }
 
 func (this *TX) exec(query string, args ...interface{}) (sql.Result, error) {
-	ret, err := this.conn.Exec(query, args...)
+	ret, err := this.conn.ExecContext(this.ctx, query, args...)
 	if err != nil {
 		// retry once on error
 		log.Debug("retry exec on", err)
-		return this.conn.Exec(query, args...)
+		return this.conn.ExecContext(this.ctx, query, args...)
 	}
 	return ret, nil
 }
 
+// WithContext returns a connector which runs with ctx,
+// the request id in ctx is logged, see package requestid.
+func (this *DB) WithContext(ctx context.Context) Connector {
+	db := *this
+	db.ctx = ctx
+	return &db
+}
+
 func (this *DB) Begin() (Connector, error) {
 	name := this.name + "-" + token()
-	log.Debug(this.name, "begin", name)
+	log.Debug(requestid.Prefix(this.ctx, this.name, "begin", name)...)
 	conn, err := this.begin()
 	if err != nil {
 		return nil, err
 	}
-	tx := &TX{name: name, conn: conn}
+	tx := &TX{name: name, conn: conn, ctx: this.ctx}
 	return tx, nil
 }
 
 func (this *DB) Commit() error {
-	log.Error(this.name, "commit", METHOD_NOT_ALLOW)
+	log.Error(requestid.Prefix(this.ctx, this.name, "commit", METHOD_NOT_ALLOW)...)
 	return METHOD_NOT_ALLOW
 }
 
 func (this *DB) Rollback() error {
-	log.Error(this.name, "rollback", METHOD_NOT_ALLOW)
+	log.Error(requestid.Prefix(this.ctx, this.name, "rollback", METHOD_NOT_ALLOW)...)
 	return METHOD_NOT_ALLOW
 }
 
 func (this *DB) Query(destList interface{}, sql string, params ...interface{}) error {
-	log.Debug(this.name, "query", sql, params)
+	log.Debug(requestid.Prefix(this.ctx, this.name, "query", sql, params)...)
 	stmt, err := this.prepare(sql)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
-	rows, err := stmt.Query(params...)
+	rows, err := stmt.QueryContext(this.ctx, params...)
 	if err != nil {
 		return err
 	}
@@ -126,13 +138,13 @@ func (this *DB) Query(destList interface{}, sql string, params ...interface{}) e
 }
 
 func (this *DB) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
-	log.Debug(this.name, "queryone", sql, params)
+	log.Debug(requestid.Prefix(this.ctx, this.name, "queryone", sql, params)...)
 	stmt, err := this.prepare(sql)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
-	rows, err := stmt.Query(params...)
+	rows, err := stmt.QueryContext(this.ctx, params...)
 	if err != nil {
 		return err
 	}
@@ -140,7 +152,7 @@ func (this *DB) QueryOne(destObject interface{}, sql string, params ...interface
 }
 
 func (this *DB) Insert(sql string, params ...interface{}) (int64, error) {
-	log.Debug(this.name, "insert", sql, params)
+	log.Debug(requestid.Prefix(this.ctx, this.name, "insert", sql, params)...)
 	ret, err := this.exec(sql, params...)
 	if err != nil {
 		return 0, err
@@ -149,53 +161,58 @@ func (this *DB) Insert(sql string, params ...interface{}) (int64, error) {
 }
 
 func (this *DB) Execute(sql string, params ...interface{}) (int64, error) {
-	log.Debug(this.name, "execute", sql, params)
+	log.Debug(requestid.Prefix(this.ctx, this.name, "execute", sql, params)...)
 	ret, err := this.exec(sql, params...)
 	if err != nil {
 		return 0, err
 	}
 	return ret.RowsAffected()
 }
+func (this *TX) WithContext(ctx context.Context) Connector {
+	tx := *this
+	tx.ctx = ctx
+	return &tx
+}
 func (this *TX) Begin() (Connector, error) {
-	log.Error(this.name, "begin", METHOD_NOT_ALLOW)
+	log.Error(requestid.Prefix(this.ctx, this.name, "begin", METHOD_NOT_ALLOW)...)
 	return nil, METHOD_NOT_ALLOW
 }
 func (this *TX) Commit() error {
-	log.Debug(this.name, "commit")
+	log.Debug(requestid.Prefix(this.ctx, this.name, "commit")...)
 	return this.conn.Commit()
 }
 func (this *TX) Rollback() error {
-	log.Debug(this.name, "rollback")
+	log.Debug(requestid.Prefix(this.ctx, this.name, "rollback")...)
 	return this.conn.Rollback()
 }
 func (this *TX) Query(destList interface{}, sql string, params ...interface{}) error {
-	log.Debug(this.name, "query", sql, params)
+	log.Debug(requestid.Prefix(this.ctx, this.name, "query", sql, params)...)
 	stmt, err := this.prepare(sql)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
-	rows, err := stmt.Query(params...)
+	rows, err := stmt.QueryContext(this.ctx, params...)
 	if err != nil {
 		return err
 	}
 	return scanQueryRows(destList, rows)
 }
 func (this *TX) QueryOne(destObject interface{}, sql string, params ...interface{}) error {
-	log.Debug(this.name, "queryone", sql, params)
+	log.Debug(requestid.Prefix(this.ctx, this.name, "queryone", sql, params)...)
 	stmt, err := this.prepare(sql)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
-	rows, err := stmt.Query(params...)
+	rows, err := stmt.QueryContext(this.ctx, params...)
 	if err != nil {
 		return err
 	}
 	return scanQueryOne(destObject, rows)
 }
 func (this *TX) Insert(sql string, params ...interface{}) (lastInsertId int64, err error) {
-	log.Debug(this.name, "insert", sql, params)
+	log.Debug(requestid.Prefix(this.ctx, this.name, "insert", sql, params)...)
 	ret, err := this.exec(sql, params...)
 	if err != nil {
 		return 0, err
@@ -203,7 +220,7 @@ func (this *TX) Insert(sql string, params ...interface{}) (lastInsertId int64, e
 	return ret.LastInsertId()
 }
 func (this *TX) Execute(sql string, params ...interface{}) (int64, error) {
-	log.Debug(this.name, "execute", sql, params)
+	log.Debug(requestid.Prefix(this.ctx, this.name, "execute", sql, params)...)
 	ret, err := this.exec(sql, params...)
 	if err != nil {
 		return 0, err
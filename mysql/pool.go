@@ -1,5 +1,9 @@
 package mysql
 
+import (
+	"context"
+)
+
 type Connector interface {
 	Begin() (Connector, error)
 	Commit() error
@@ -10,6 +14,22 @@ type Connector interface {
 	Execute(sql string, params ...interface{}) (affectRows int64, err error)
 }
 
+// ContextConnector is a Connector which can run with a context,
+// DB, TX and TestDB implement it.
+type ContextConnector interface {
+	Connector
+	WithContext(ctx context.Context) Connector
+}
+
+// WithContext returns conn running with ctx if it is a ContextConnector,
+// otherwise conn itself is returned.
+func WithContext(conn Connector, ctx context.Context) Connector {
+	if cc, ok := conn.(ContextConnector); ok {
+		return cc.WithContext(ctx)
+	}
+	return conn
+}
+
 type _Pool struct {
 	pool map[string]Connector
 }
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -12,6 +13,9 @@ func NewTestDB() *TestDB {
 	return &TestDB{}
 }
 
+func (this *TestDB) WithContext(ctx context.Context) Connector {
+	return this
+}
 func (this *TestDB) Begin() (Connector, error) {
 	log.Info("begin a transaction")
 	return this, nil
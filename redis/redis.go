@@ -1,6 +1,8 @@
 package redis
 
 import (
+	"context"
+	"git.lcgc.work/platform/kelp/requestid"
 	"github.com/go-redis/redis"
 	"strconv"
 	"time"
@@ -15,6 +17,7 @@ type _RedisPool struct {
 type rdbQuery struct {
 	client *redis.Client
 	alias  string
+	ctx    context.Context
 }
 
 type rdbConnector interface {
@@ -53,54 +56,70 @@ func UseRedis(name string) *rdbQuery {
 	return redisPool.pool[name]
 }
 
+// WithContext returns a query which runs with ctx,
+// the request id in ctx is logged, see package requestid.
+func (rdq *rdbQuery) WithContext(ctx context.Context) *rdbQuery {
+	return &rdbQuery{
+		client: rdq.client.WithContext(ctx),
+		alias:  rdq.alias,
+		ctx:    ctx,
+	}
+}
+
 func (rdq *rdbQuery) Get(key string) (string, error) {
-	log.Debug("[get redis]", "[redis: "+rdq.alias+"]", "GET ", key)
+	log.Debug(requestid.Prefix(rdq.ctx, "[get redis]", "[redis: "+rdq.alias+"]", "GET ", key)...)
 	return rdq.client.Get(key).Result()
 }
 
 func (rdq *rdbQuery) Set(key, value string, expiration time.Duration) error {
-	log.Debug("[set redis]", "[redis: "+rdq.alias+"]", "SET ", key, value)
+	log.Debug(requestid.Prefix(rdq.ctx, "[set redis]", "[redis: "+rdq.alias+"]", "SET ", key, value)...)
 	return rdq.client.Set(key, value, expiration).Err()
 }
 
 func (rdq *rdbQuery) SetNX(key, value string, expiration time.Duration) error {
 	// 当且仅当key不存在时，将key的值设为value
-	log.Debug("[setNX redis]", "[redis: "+rdq.alias+"]", "SETNX ", key, value)
+	log.Debug(requestid.Prefix(rdq.ctx, "[setNX redis]", "[redis: "+rdq.alias+"]", "SETNX ", key, value)...)
 	return rdq.client.SetNX(key, value, expiration).Err()
 }
 
 func (rdq *rdbQuery) SetXX(key, value string, expiration time.Duration) error {
 	// 当且仅当key存在时，将key的值设为value
-	log.Debug("[setXX redis]", "[redis: "+rdq.alias+"]", "SETXX ", key, value)
+	log.Debug(requestid.Prefix(rdq.ctx, "[setXX redis]", "[redis: "+rdq.alias+"]", "SETXX ", key, value)...)
 	return rdq.client.SetXX(key, value, expiration).Err()
 }
 
 func (rdq *rdbQuery) Incr(key string) (int64, error) {
-	log.Debug("[incr redis]", "[redis: "+rdq.alias+"]", "Incr ", key)
+	log.Debug(requestid.Prefix(rdq.ctx, "[incr redis]", "[redis: "+rdq.alias+"]", "Incr ", key)...)
 	return rdq.client.Incr(key).Result()
 }
 
 func (rdq *rdbQuery) Decr(key string) (int64, error) {
-	log.Debug("[decr redis]", "[redis: "+rdq.alias+"]", "Decr ", key)
+	log.Debug(requestid.Prefix(rdq.ctx, "[decr redis]", "[redis: "+rdq.alias+"]", "Decr ", key)...)
 	return rdq.client.Decr(key).Result()
 }
 
 func (rdq *rdbQuery) Del(key string) error {
-	log.Debug("[del redis]", "[redis: "+rdq.alias+"]", "Del ", key)
+	log.Debug(requestid.Prefix(rdq.ctx, "[del redis]", "[redis: "+rdq.alias+"]", "Del ", key)...)
 	return rdq.client.Del(key).Err()
 }
 
 func (rdq *rdbQuery) ExpireAt(key string, tm time.Time) error {
-	log.Debug("[expireat redis]", "[redis: "+rdq.alias+"]", "ExpireAt", key)
+	log.Debug(requestid.Prefix(rdq.ctx, "[expireat redis]", "[redis: "+rdq.alias+"]", "ExpireAt", key)...)
 	return rdq.client.ExpireAt(key, tm).Err()
 }
 
 func (rdq *rdbQuery) Expire(key string, expiration time.Duration) error {
-	log.Debug("[expire redis]", "[redis: "+rdq.alias+"]", "Expire", key)
+	log.Debug(requestid.Prefix(rdq.ctx, "[expire redis]", "[redis: "+rdq.alias+"]", "Expire", key)...)
 	return rdq.client.Expire(key, expiration).Err()
 }
 
 func (rdq *rdbQuery) Exists(key ...string) int64 {
-	log.Debug("[exists redis]", "[redis: "+rdq.alias+"]", "Exists", key)
-	return rdq.client.Exists(key).Val()
+	log.Debug(requestid.Prefix(rdq.ctx, "[exists redis]", "[redis: "+rdq.alias+"]", "Exists", key)...)
+	return rdq.client.Exists(key...).Val()
+}
+
+// Eval runs a lua script atomically, the script is cached by redis and run by EVALSHA after the first time
+func (rdq *rdbQuery) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	log.Debug(requestid.Prefix(rdq.ctx, "[eval redis]", "[redis: "+rdq.alias+"]", "Eval", keys)...)
+	return redis.NewScript(script).Run(rdq.client, keys, args...).Result()
 }
@@ -37,3 +37,17 @@ func TestRedis(t *testing.T) {
 		t.Fatal("redis DEL error, key: key2")
 	}
 }
+
+func TestEval(t *testing.T) {
+	client := UseRedis("test")
+	client.Del("eval")
+	script := "return redis.call('INCRBY', KEYS[1], ARGV[1])"
+	if val, err := client.Eval(script, []string{"eval"}, 2); err != nil || val.(int64) != 2 {
+		t.Fatal("redis EVAL error:", val, err)
+	}
+	// run by EVALSHA
+	if val, err := client.Eval(script, []string{"eval"}, 3); err != nil || val.(int64) != 5 {
+		t.Fatal("redis EVALSHA error:", val, err)
+	}
+	client.Del("eval")
+}
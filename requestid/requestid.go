@@ -0,0 +1,70 @@
+package requestid
+
+// requestid模块在context中传递请求id，web、grpc、mysql和redis模块都会读取它，
+// 这样一个请求在各个模块中的日志可以串联起来
+//
+// web.RequestId()中间件接收或生成请求id，grpc客户端把它作为metadata发送，
+// grpc.RequestId拦截器在服务端读取它
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const (
+	// Header is the http header of request id
+	Header = "X-Request-Id"
+	// MetadataKey is the grpc metadata key of request id
+	MetadataKey = "x-request-id"
+
+	_MAX_LENGTH = 128
+)
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns "" if there is no request id in ctx
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Prefix prefixes msg with "[id]" if there is a request id in ctx,
+// it is the format of request id in logs of every module.
+func Prefix(ctx context.Context, msg ...interface{}) []interface{} {
+	if id := FromContext(ctx); id != "" {
+		return append([]interface{}{"[" + id + "]"}, msg...)
+	}
+	return msg
+}
+
+// New generates a random id of 32 hex characters
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Valid checks the id from clients, which is written into logs and headers,
+// only letters, digits and "-_.:" are allowed.
+func Valid(id string) bool {
+	if id == "" || len(id) > _MAX_LENGTH {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
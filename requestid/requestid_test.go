@@ -0,0 +1,35 @@
+package requestid
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRequestId(t *testing.T) {
+	id := New()
+	if len(id) != 32 || !Valid(id) || New() == id {
+		t.Error(id)
+	}
+	ctx := NewContext(context.Background(), id)
+	if FromContext(ctx) != id || FromContext(context.Background()) != "" || FromContext(nil) != "" {
+		t.Error("request id is not in context")
+	}
+	if prefixed := Prefix(ctx, "msg"); len(prefixed) != 2 || prefixed[0] != "["+id+"]" {
+		t.Error(prefixed)
+	}
+	if prefixed := Prefix(context.Background(), "msg"); len(prefixed) != 1 {
+		t.Error(prefixed)
+	}
+	cases := map[string]bool{
+		"":                        false,
+		"abc-123_x.y:z":           true,
+		"a b":                     false,
+		"a\nb":                    false,
+		string(make([]byte, 129)): false,
+	}
+	for id, expect := range cases {
+		if Valid(id) != expect {
+			t.Error(id, expect)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	AccessLogJSON     = "json"
+	AccessLogCombined = "combined"
+
+	_ACCESS_LOG_MAX_BODY_BYTES = 1024
+	// bodies are captured up to 64KB, so json in them can be redacted before truncated
+	_ACCESS_LOG_CAPTURE_BYTES = 64 << 10
+	_ACCESS_LOG_REDACTED      = "***"
+)
+
+type AccessLogOptions struct {
+	// Format is AccessLogJSON, AccessLogCombined or a text/template of AccessLogEntry,
+	// like `{{.Method}} {{.Path}} {{.Status}} {{.Latency}}`. Default AccessLogJSON.
+	Format string
+	// Logger is where the lines are written by Info, such as log.Get("access") of the log package,
+	// default the logger set by SetLogger.
+	Logger logInterface
+
+	// Headers are the request headers logged in Entry.Headers
+	Headers []string
+	// RedactHeaders are logged as "***", such as Authorization and Cookie
+	RedactHeaders []string
+	// RedactJSON are paths of fields in json bodies logged as "***",
+	// like "password", "user.token" or "cards.*.number", "*" matches any key or index.
+	// A json body which can not be parsed, such as a too large one, is not logged.
+	RedactJSON []string
+	// RedactForm are fields in application/x-www-form-urlencoded bodies logged as "***",
+	// like "password" or "card[number]". Other bodies, such as multipart, are not redacted.
+	RedactForm []string
+
+	// bodies are not logged by default
+	RequestBody  bool
+	ResponseBody bool
+	// MaxBodyBytes truncates the logged bodies, default 1KB
+	MaxBodyBytes int
+
+	// SkipPaths are not logged, such as "/health", a trailing "*" matches the prefix
+	SkipPaths []string
+	// SampleRate is the part of requests logged, such as 0.1,
+	// 0 means all. Responses with status 5xx are always logged.
+	SampleRate float64
+}
+
+type AccessLogEntry struct {
+	Time            time.Time         `json:"time"`
+	RemoteIP        string            `json:"remote_ip"`
+	RequestId       string            `json:"request_id,omitempty"`
+	User            string            `json:"user,omitempty"`
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Query           string            `json:"query,omitempty"`
+	Proto           string            `json:"proto"`
+	Status          int               `json:"status"`
+	Size            int64             `json:"size"`
+	Latency         time.Duration     `json:"latency"`
+	TimeToFirstByte time.Duration     `json:"ttfb"`
+	Referer         string            `json:"referer,omitempty"`
+	UserAgent       string            `json:"user_agent,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+}
+
+// AccessLog logs a line for every request after it is handled,
+// it should be used before other handlers to get the right latency.
+//
+//	server.Use(web.AccessLog(web.AccessLogOptions{
+//		Logger:        log.Get("access"),
+//		RedactHeaders: []string{"Authorization"},
+//		RedactJSON:    []string{"password"},
+//		SkipPaths:     []string{"/health"},
+//	}))
+func AccessLog(opts AccessLogOptions) HandlerFunc {
+	var tmpl *template.Template
+	switch opts.Format {
+	case "", AccessLogJSON, AccessLogCombined:
+	default:
+		var err error
+		tmpl, err = template.New("access_log").Parse(opts.Format)
+		if err != nil {
+			panic("access log format invalid " + err.Error())
+		}
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = _ACCESS_LOG_MAX_BODY_BYTES
+	}
+	redactHeaders := map[string]bool{}
+	for _, header := range opts.RedactHeaders {
+		redactHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+	redactJSON := [][]string{}
+	for _, path := range opts.RedactJSON {
+		redactJSON = append(redactJSON, strings.Split(path, "."))
+	}
+	redactForm := map[string]bool{}
+	for _, field := range opts.RedactForm {
+		redactForm[field] = true
+	}
+
+	return func(c *Context) {
+		if skipPath(c.Request.URL.Path, opts.SkipPaths) {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		if opts.ResponseBody && c.writer != nil {
+			c.writer.captureLimit = _ACCESS_LOG_CAPTURE_BYTES
+		}
+
+		c.Next()
+
+		status := c.HttpStatus
+		if status == 0 {
+			// nothing is written, net/http responds 200
+			status = http.StatusOK
+		}
+		if opts.SampleRate > 0 && opts.SampleRate < 1 && status < 500 && rand.Float64() >= opts.SampleRate {
+			return
+		}
+		entry := &AccessLogEntry{
+			Time:            start,
+			RemoteIP:        c.ClientIP(),
+			RequestId:       c.RequestId(),
+			Method:          c.Request.Method,
+			Path:            c.Request.URL.Path,
+			Query:           c.Request.URL.RawQuery,
+			Proto:           c.Request.Proto,
+			Status:          status,
+			Size:            c.ResponseSize(),
+			Latency:         time.Since(start),
+			TimeToFirstByte: c.TimeToFirstByte(),
+		}
+		if user, _, ok := c.Request.BasicAuth(); ok {
+			entry.User = user
+		}
+		header := func(name string) string {
+			value := c.Request.Header.Get(name)
+			if value != "" && redactHeaders[http.CanonicalHeaderKey(name)] {
+				return _ACCESS_LOG_REDACTED
+			}
+			return value
+		}
+		entry.Referer = header("Referer")
+		entry.UserAgent = header("User-Agent")
+		if len(opts.Headers) > 0 {
+			entry.Headers = map[string]string{}
+			for _, name := range opts.Headers {
+				if value := header(name); value != "" {
+					entry.Headers[name] = value
+				}
+			}
+		}
+		if opts.RequestBody {
+			// the body is logged only if it was read by handlers
+			entry.RequestBody = logBody(c.Body, c.Request.Header.Get("Content-Type"), redactJSON, redactForm, opts.MaxBodyBytes)
+		}
+		if opts.ResponseBody && c.writer != nil {
+			entry.ResponseBody = logBody(c.writer.captured, c.ResponseWriter.Header().Get("Content-Type"), redactJSON, redactForm, opts.MaxBodyBytes)
+		}
+
+		logger := opts.Logger
+		if logger == nil {
+			logger = log
+		}
+		switch {
+		case tmpl != nil:
+			buf := &bytes.Buffer{}
+			if err := tmpl.Execute(buf, entry); err != nil {
+				log.Error("access log faild", err)
+				return
+			}
+			logger.Info(buf.String())
+		case opts.Format == AccessLogCombined:
+			logger.Info(entry.combined())
+		default:
+			out, err := json.Marshal(entry)
+			if err != nil {
+				log.Error("access log faild", err)
+				return
+			}
+			logger.Info(string(out))
+		}
+	}
+}
+
+// combined is the Apache combined log format
+func (this *AccessLogEntry) combined() string {
+	size := "-"
+	if this.Size > 0 {
+		size = fmt.Sprint(this.Size)
+	}
+	uri := this.Path
+	if this.Query != "" {
+		uri += "?" + this.Query
+	}
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s "%s" "%s"`,
+		this.RemoteIP, str(this.User), this.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		this.Method, uri, this.Proto, this.Status, size, str(this.Referer), str(this.UserAgent))
+}
+
+func skipPath(path string, skipPaths []string) bool {
+	for _, skip := range skipPaths {
+		if strings.HasSuffix(skip, "*") {
+			if strings.HasPrefix(path, skip[:len(skip)-1]) {
+				return true
+			}
+		} else if path == skip {
+			return true
+		}
+	}
+	return false
+}
+
+// logBody redacts the json or form fields then truncates the body
+func logBody(body []byte, contentType string, redactJSON [][]string, redactForm map[string]bool, maxBytes int) string {
+	if len(body) == 0 {
+		return ""
+	}
+	trimmed := bytes.TrimSpace(body)
+	if strings.HasPrefix(strings.ToLower(contentType), "application/x-www-form-urlencoded") {
+		if len(redactForm) > 0 {
+			form, ok := redactFormBody(string(body), redactForm)
+			if !ok {
+				return "[body omitted]"
+			}
+			body = []byte(form)
+		}
+	} else if len(redactJSON) > 0 && len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		var data interface{}
+		if err := json.Unmarshal(trimmed, &data); err != nil {
+			// it may be cut off, never log fields which should be redacted
+			return "[body omitted]"
+		}
+		for _, path := range redactJSON {
+			redact(data, path)
+		}
+		body, _ = json.Marshal(data)
+	}
+	if len(body) > maxBytes {
+		return string(body[:maxBytes]) + "...(truncated)"
+	}
+	return string(body)
+}
+
+// redactFormBody keeps the order and encoding of the fields not redacted
+func redactFormBody(body string, fields map[string]bool) (string, bool) {
+	pairs := strings.Split(body, "&")
+	for i, pair := range pairs {
+		rawKey := pair
+		if j := strings.IndexByte(pair, '='); j >= 0 {
+			rawKey = pair[:j]
+		}
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			return "", false
+		}
+		if fields[key] {
+			pairs[i] = rawKey + "=" + _ACCESS_LOG_REDACTED
+		}
+	}
+	return strings.Join(pairs, "&"), true
+}
+
+func redact(data interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	key, last := path[0], len(path) == 1
+	switch d := data.(type) {
+	case map[string]interface{}:
+		for k, v := range d {
+			if key != "*" && k != key {
+				continue
+			}
+			if last {
+				d[k] = _ACCESS_LOG_REDACTED
+			} else {
+				redact(v, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, v := range d {
+			if key != "*" && key != fmt.Sprint(i) {
+				continue
+			}
+			if last {
+				d[i] = _ACCESS_LOG_REDACTED
+			} else {
+				redact(v, path[1:])
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordLogger struct {
+	quietLogger
+	mux   sync.Mutex
+	lines []string
+}
+
+func (lg *recordLogger) Info(msg ...interface{}) {
+	lg.mux.Lock()
+	defer lg.mux.Unlock()
+	lg.lines = append(lg.lines, fmt.Sprint(msg...))
+}
+
+func (lg *recordLogger) take() []string {
+	lg.mux.Lock()
+	defer lg.mux.Unlock()
+	lines := lg.lines
+	lg.lines = nil
+	return lines
+}
+
+func TestAccessLog(t *testing.T) {
+	logger := &recordLogger{}
+	s := New("")
+	s.Use(AccessLog(AccessLogOptions{
+		Logger:        logger,
+		Headers:       []string{"Authorization", "X-Client"},
+		RedactHeaders: []string{"authorization"},
+		RedactJSON:    []string{"password", "cards.*.number"},
+		RedactForm:    []string{"password", "card[number]"},
+		RequestBody:   true,
+		ResponseBody:  true,
+		MaxBodyBytes:  64,
+		SkipPaths:     []string{"/health", "/static/*"},
+	}))
+	s.POST("/login", func(c *Context) {
+		c.RawBody()
+		c.Json(map[string]interface{}{"token": "t", "cards": []map[string]string{{"number": "4111"}}})
+	})
+	s.POST("/form", func(c *Context) {
+		c.RawBody()
+		c.Text("ok")
+	})
+	s.GET("/health", func(c *Context) { c.Text("ok") })
+	s.GET("/static/*file", func(c *Context) { c.Text("ok") })
+	s.GET("/large", func(c *Context) {
+		c.ResponseWriter.Write([]byte(strings.Repeat("a", 100)))
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	req, _ := http.NewRequest("POST", ts.URL+"/login?from=app", strings.NewReader(`{"name":"kelp","password":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("X-Client", "ios")
+	res, _ := http.DefaultClient.Do(req)
+	res.Body.Close()
+	res, _ = http.Post(ts.URL+"/form", "application/x-www-form-urlencoded", strings.NewReader("name=kelp&password=secret&card%5Bnumber%5D=4111"))
+	res.Body.Close()
+	for _, path := range []string{"/health", "/static/a.js", "/large"} {
+		res, _ = http.Get(ts.URL + path)
+		res.Body.Close()
+	}
+
+	lines := logger.take()
+	if len(lines) != 3 {
+		t.Fatal(lines)
+	}
+	entry := AccessLogEntry{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Method != "POST" || entry.Path != "/login" || entry.Query != "from=app" || entry.Status != 200 || entry.Size == 0 {
+		t.Error(lines[0])
+	}
+	if entry.Headers["Authorization"] != "***" || entry.Headers["X-Client"] != "ios" {
+		t.Error(entry.Headers)
+	}
+	if entry.RequestBody != `{"name":"kelp","password":"***"}` {
+		t.Error(entry.RequestBody)
+	}
+	if entry.ResponseBody != `{"cards":[{"number":"***"}],"token":"t"}` {
+		t.Error(entry.ResponseBody)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry.RequestBody != "name=kelp&password=***&card%5Bnumber%5D=***" {
+		t.Error(lines[1])
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &entry); err != nil || entry.ResponseBody != strings.Repeat("a", 64)+"...(truncated)" {
+		t.Error(lines[2])
+	}
+}
+
+func TestAccessLogFormat(t *testing.T) {
+	cases := map[string]string{
+		AccessLogCombined:                   `127.0.0.1 - kelp [`,
+		`{{.Method}} {{.Path}} {{.Status}}`: `GET /a 404`,
+	}
+	for format, expect := range cases {
+		logger := &recordLogger{}
+		s := New("")
+		s.Use(AccessLog(AccessLogOptions{Format: format, Logger: logger}))
+		ts := s.RunTest()
+		req, _ := http.NewRequest("GET", ts.URL+"/a", nil)
+		req.SetBasicAuth("kelp", "pass")
+		res, _ := http.DefaultClient.Do(req)
+		res.Body.Close()
+		ts.Close()
+		lines := logger.take()
+		if len(lines) != 1 || !strings.HasPrefix(lines[0], expect) {
+			t.Error(format, lines)
+		}
+		if format == AccessLogCombined && !strings.Contains(lines[0], `"GET /a HTTP/1.1" 404 - "-" "Go-http-client/1.1"`) {
+			t.Error(lines[0])
+		}
+	}
+
+	// errors are always logged
+	logger := &recordLogger{}
+	s := New("")
+	s.Use(AccessLog(AccessLogOptions{Logger: logger, SampleRate: 0.000001}))
+	s.GET("/ok", func(c *Context) { c.Text("ok") })
+	s.GET("/fail", func(c *Context) { c.DieWithHttpStatus(500) })
+	ts := s.RunTest()
+	defer ts.Close()
+	for _, path := range []string{"/ok", "/fail"} {
+		res, _ := http.Get(ts.URL + path)
+		res.Body.Close()
+	}
+	if lines := logger.take(); len(lines) != 1 || !strings.Contains(lines[0], `"status":500`) {
+		t.Error(lines)
+	}
+}
@@ -0,0 +1,207 @@
+package web
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// BindQuery binds url query to dest by tag `query:"name"`, then valid it
+func (this *Context) BindQuery(dest interface{}) error {
+	return bindValues(dest, "query", this.Request.URL.Query())
+}
+
+// BindForm binds urlencoded or multipart form body to dest by tag `form:"name"`, then valid it
+func (this *Context) BindForm(dest interface{}) error {
+	if err := this.parseForm(); err != nil {
+		return err
+	}
+	return bindValues(dest, "form", this.Request.PostForm)
+}
+
+// BindUri binds path params to dest by tag `uri:"name"`, then valid it
+func (this *Context) BindUri(dest interface{}) error {
+	values := map[string][]string{}
+	for _, param := range this.Params {
+		values[param.key] = append(values[param.key], param.value)
+	}
+	return bindValues(dest, "uri", values)
+}
+
+// BindHeader binds request headers to dest by tag `header:"name"`, then valid it
+func (this *Context) BindHeader(dest interface{}) error {
+	return bindValues(dest, "header", this.Request.Header, textproto.CanonicalMIMEHeaderKey)
+}
+
+// ShouldBind chooses the binding by Content-Type:
+//
+//	application/json                    Bind
+//	application/xml, text/xml           xml body
+//	application/x-www-form-urlencoded   BindForm
+//	multipart/form-data                 BindForm
+//	no body with GET, HEAD or DELETE    BindQuery
+func (this *Context) ShouldBind(dest interface{}) error {
+	contentType := this.Request.Header.Get("Content-Type")
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	switch strings.TrimSpace(strings.ToLower(contentType)) {
+	case "application/json":
+		return this.Bind(dest)
+	case "application/xml", "text/xml":
+		if err := xml.NewDecoder(this.Request.Body).Decode(dest); err != nil {
+			return err
+		}
+		return Valid(dest)
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		return this.BindForm(dest)
+	case "":
+		switch this.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+			return this.BindQuery(dest)
+		}
+	}
+	return fmt.Errorf("bind failed, unsupported content type %q", contentType)
+}
+
+func (this *Context) parseForm() error {
+	if strings.HasPrefix(this.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		// the same parsing as uploads, so the form is read once with the upload options
+		_, err := this.MultipartForm()
+		return err
+	}
+	return this.Request.ParseForm()
+}
+
+// bindValues sets the fields of dest by tag,
+// a field without tag is bound by its name, a tag "-" skips the field.
+func bindValues(dest interface{}, tag string, values map[string][]string, keyFuncs ...func(string) string) error {
+	rootValue := reflect.ValueOf(dest)
+	if rootValue.Kind() != reflect.Ptr || rootValue.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind failed, dest should be a *struct but %s", rootValue.Kind())
+	}
+	if err := bindStruct(rootValue.Elem(), tag, values, keyFuncs); err != nil {
+		return err
+	}
+	return Valid(dest)
+}
+
+func bindStruct(dest reflect.Value, tag string, values map[string][]string, keyFuncs []func(string) string) error {
+	for i := 0; i < dest.NumField(); i++ {
+		field := dest.Type().Field(i)
+		fieldValue := dest.Field(i)
+		if !fieldValue.CanSet() {
+			continue
+		}
+		key, hasTag := field.Tag.Lookup(tag)
+		if comma := strings.IndexByte(key, ','); comma >= 0 {
+			key = key[:comma]
+		}
+		if key == "-" {
+			continue
+		}
+		if !hasTag && field.Type.Kind() == reflect.Struct && field.Type != timeType {
+			if err := bindStruct(fieldValue, tag, values, keyFuncs); err != nil {
+				return err
+			}
+			continue
+		}
+		if key == "" {
+			key = field.Name
+		}
+		for _, f := range keyFuncs {
+			key = f(key)
+		}
+		value, ok := values[key]
+		if !ok || len(value) < 1 {
+			continue
+		}
+		if err := setField(fieldValue, value); err != nil {
+			return fmt.Errorf("bind failed, field %s: %v", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, values []string) error {
+	switch field.Kind() {
+	case reflect.Ptr:
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return setField(field.Elem(), values)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return setValue(field, values[0])
+}
+
+func setValue(field reflect.Value, value string) error {
+	if field.Kind() != reflect.String && value == "" {
+		return nil
+	}
+	switch field.Type() {
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	case timeType:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package web
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindModel struct {
+	Name    string        `query:"name" form:"name" uri:"name" header:"x-name" valid:"/^[a-z]+$/"`
+	Age     int           `query:"age" form:"age" uri:"age"`
+	Tags    []string      `query:"tag" form:"tag"`
+	Score   *float64      `query:"score"`
+	Timeout time.Duration `query:"timeout"`
+	Token   string        `header:"Authorization"`
+	Skip    string        `query:"-" form:"-"`
+	Page    struct {
+		Limit int `query:"limit"`
+	}
+}
+
+func TestBindQuery(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?name=abc&age=12&tag=a&tag=b&score=1.5&timeout=2s&limit=10&Skip=x", nil)
+	c := newContext(httptest.NewRecorder(), req)
+	m := &bindModel{}
+	if err := c.ShouldBind(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "abc" || m.Age != 12 || strings.Join(m.Tags, ",") != "a,b" ||
+		m.Score == nil || *m.Score != 1.5 || m.Timeout != 2*time.Second ||
+		m.Page.Limit != 10 || m.Skip != "" {
+		t.Error(m)
+	}
+
+	req = httptest.NewRequest("GET", "/?name=ABC", nil)
+	if err := newContext(httptest.NewRecorder(), req).BindQuery(&bindModel{}); err == nil {
+		t.Error("should be invalid")
+	}
+	req = httptest.NewRequest("GET", "/?name=abc&age=x", nil)
+	if err := newContext(httptest.NewRecorder(), req).BindQuery(&bindModel{}); err == nil {
+		t.Error("age should be int")
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	req := httptest.NewRequest("POST", "/?name=query", strings.NewReader("name=abc&age=12&tag=a"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	m := &bindModel{}
+	if err := newContext(httptest.NewRecorder(), req).ShouldBind(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "abc" || m.Age != 12 || strings.Join(m.Tags, ",") != "a" {
+		t.Error(m)
+	}
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	w.WriteField("name", "multi")
+	w.WriteField("age", "3")
+	w.Close()
+	req = httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	m = &bindModel{}
+	if err := newContext(httptest.NewRecorder(), req).ShouldBind(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "multi" || m.Age != 3 {
+		t.Error(m)
+	}
+}
+
+func TestBindUriAndHeader(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Name", "abc")
+	req.Header.Set("Authorization", "token")
+	c := newContext(httptest.NewRecorder(), req)
+	c.Params = Params{{"name", "abc"}, {"age", "42"}}
+	m := &bindModel{}
+	if err := c.BindUri(m); err != nil || m.Name != "abc" || m.Age != 42 {
+		t.Error(m, err)
+	}
+	m = &bindModel{}
+	if err := c.BindHeader(m); err != nil || m.Name != "abc" || m.Token != "token" {
+		t.Error(m, err)
+	}
+}
+
+func TestShouldBindContentType(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"Name":"abc"}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	m := &bindModel{}
+	if err := newContext(httptest.NewRecorder(), req).ShouldBind(m); err != nil || m.Name != "abc" {
+		t.Error(m, err)
+	}
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`<bindModel><Name>abc</Name></bindModel>`))
+	req.Header.Set("Content-Type", "application/xml")
+	m = &bindModel{}
+	if err := newContext(httptest.NewRecorder(), req).ShouldBind(m); err != nil || m.Name != "abc" {
+		t.Error(m, err)
+	}
+	req = httptest.NewRequest("POST", "/", strings.NewReader(`abc`))
+	req.Header.Set("Content-Type", "text/plain")
+	if err := newContext(httptest.NewRecorder(), req).ShouldBind(&bindModel{}); err == nil {
+		t.Error("text/plain should not be supported")
+	}
+}
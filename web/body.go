@@ -0,0 +1,101 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// _DEFAULT_MAX_BODY_BYTES limits bodies unless the server or router sets a limit,
+// json bodies are read before handlers, so they are never read unbounded.
+const _DEFAULT_MAX_BODY_BYTES = 10 << 20
+
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// SetMaxBodyBytes limits the request body of all routers, default 10MB, negative or 0 means no limit
+func (this *Server) SetMaxBodyBytes(n int64) {
+	if n <= 0 {
+		n = -1
+	}
+	this.router.maxBodyBytes = n
+}
+
+// MaxBodyBytes limits the request body of this router and routers below it,
+// it overrides the limit of server, negative means no limit.
+func (this *Router) MaxBodyBytes(n int64) *Router {
+	this.maxBodyBytes = n
+	return this
+}
+
+// bodyLimit returns the limit of the nearest router which sets it
+func (this *Router) bodyLimit() int64 {
+	for router := this; router != nil; router = router.parent {
+		if router.maxBodyBytes != 0 {
+			return router.maxBodyBytes
+		}
+	}
+	return 0
+}
+
+// limitBody returns false if the declared length is over the limit,
+// otherwise the body is limited when it is read.
+func (this *Context) limitBody(limit int64) bool {
+	if limit <= 0 {
+		return true
+	}
+	if this.Request.ContentLength > limit {
+		return false
+	}
+	this.Request.Body = http.MaxBytesReader(this.rawResponseWriter(), this.Request.Body, limit)
+	return true
+}
+
+// RawBody reads the request body on demand and keeps it in Body.
+// If the body is over the limit, such as a chunked one, 413 is responded and the rest handlers are aborted,
+// ErrBodyTooLarge is returned and the handler should just return.
+func (this *Context) RawBody() ([]byte, error) {
+	body, err := this.readBody()
+	if err == ErrBodyTooLarge && !this.Written() {
+		this.AbortWithStatus(413)
+	}
+	return body, err
+}
+
+// readJSONBody reads json bodies before handlers, so Body is filled as before.
+// It returns false if the body is over the limit.
+func (this *Context) readJSONBody() bool {
+	if !isJSONRequest(this.Request) {
+		return true
+	}
+	_, err := this.readBody()
+	return err != ErrBodyTooLarge
+}
+
+func isJSONRequest(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Content-Type"), "application/json")
+}
+
+func (this *Context) readBody() ([]byte, error) {
+	if this.bodyRead {
+		return this.Body, this.bodyErr
+	}
+	this.bodyRead = true
+	if this.Request.Body == nil {
+		return this.Body, nil
+	}
+	body, err := ioutil.ReadAll(this.Request.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = ErrBodyTooLarge
+		}
+		this.bodyErr = err
+		return nil, err
+	}
+	this.Body = body
+	// the body can be read again, such as by ParseForm
+	this.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
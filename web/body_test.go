@@ -0,0 +1,176 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	s := New("")
+	s.SetMaxBodyBytes(16)
+	echo := func(c *Context) {
+		body, err := c.RawBody()
+		if err == ErrBodyTooLarge {
+			return
+		}
+		again, _ := c.RawBody()
+		if !bytes.Equal(body, again) || !bytes.Equal(body, c.Body) {
+			t.Error("body should be kept")
+		}
+		c.Success(string(body))
+	}
+	s.POST("/default", echo)
+	s.POST("/large", echo).MaxBodyBytes(64)
+	s.Group("/unlimited").MaxBodyBytes(-1).POST("/echo", echo)
+	ts := s.RunTest()
+	defer ts.Close()
+
+	short := strings.Repeat("a", 10)
+	middle := strings.Repeat("a", 32)
+	long := strings.Repeat("a", 100)
+	cases := []struct {
+		path    string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{"/default", short, false, 200},
+		{"/default", middle, false, 413},
+		{"/default", middle, true, 413},
+		{"/large", middle, false, 200},
+		{"/large", long, false, 413},
+		{"/large", long, true, 413},
+		{"/unlimited/echo", long, false, 200},
+		{"/not-found", middle, false, 413},
+	}
+	for _, c := range cases {
+		var body io.Reader = strings.NewReader(c.body)
+		if c.chunked {
+			// unknown length is sent chunked
+			body = ioutil.NopCloser(body)
+		}
+		res, err := http.Post(ts.URL+c.path, "text/plain", body)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		resp, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != c.status {
+			t.Error(c.path, len(c.body), c.chunked, res.StatusCode, string(resp))
+		}
+		if c.status == 200 && string(resp) != `{"data":"`+c.body+`","status":0}` {
+			t.Error(c.path, string(resp))
+		}
+	}
+}
+
+func TestJSONBody(t *testing.T) {
+	s := New("")
+	s.SetMaxBodyBytes(16)
+	s.POST("/json", func(c *Context) {
+		// read before handlers
+		c.Text(string(c.Body))
+	})
+	s.POST("/ignore", func(c *Context) {
+		// the error is not checked
+		c.RawBody()
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	cases := []struct {
+		path        string
+		contentType string
+		body        string
+		chunked     bool
+		status      int
+		resp        string
+	}{
+		{"/json", "application/json", `{"a":1}`, false, 200, `{"a":1}`},
+		{"/json", "application/json; charset=utf-8", `{"a":1}`, true, 200, `{"a":1}`},
+		{"/json", "application/json", `{"a":"` + strings.Repeat("a", 32) + `"}`, true, 413, ""},
+		{"/json", "text/plain", "text", false, 200, ""},
+		{"/ignore", "text/plain", strings.Repeat("a", 32), true, 413, ""},
+	}
+	for _, c := range cases {
+		var body io.Reader = strings.NewReader(c.body)
+		if c.chunked {
+			body = ioutil.NopCloser(body)
+		}
+		res, err := http.Post(ts.URL+c.path, c.contentType, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != c.status || c.status == 200 && string(resp) != c.resp {
+			t.Error(c.path, c.contentType, res.StatusCode, string(resp))
+		}
+	}
+
+	// json bodies are limited by default
+	large := `{"a":"` + strings.Repeat("a", _DEFAULT_MAX_BODY_BYTES) + `"}`
+	for _, limit := range []int64{0, -1} {
+		s := New("")
+		if limit != 0 {
+			s.SetMaxBodyBytes(limit)
+		}
+		s.POST("/json", func(c *Context) {
+			c.Text(len(c.Body))
+		})
+		ts := s.RunTest()
+		res, err := http.Post(ts.URL+"/json", "application/json", ioutil.NopCloser(strings.NewReader(large)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		ts.Close()
+		if limit == 0 && res.StatusCode != 413 || limit < 0 && string(resp) != fmt.Sprint(len(large)) {
+			t.Error(limit, res.StatusCode, string(resp))
+		}
+	}
+}
+
+func TestSignCheck(t *testing.T) {
+	key := "secret"
+	s := New("")
+	s.Use(SignCheck(key))
+	s.POST("/", func(c *Context) {
+		c.Text("ok")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	form := "a=1&b=2"
+	cases := []struct {
+		contentType string
+		body        string
+		signed      string
+		status      int
+	}{
+		{"application/json", `{"a":1}`, `{"a":1}`, 200},
+		{"application/json", `{"a":1}`, "", 401},
+		// only json bodies are signed
+		{"application/x-www-form-urlencoded", form, "", 200},
+		{"application/x-www-form-urlencoded", form, form, 401},
+	}
+	for _, c := range cases {
+		token := url.QueryEscape(string(Sha1Sign([]byte(key), []byte(c.signed))))
+		res, err := http.Post(ts.URL+"/?token="+token, c.contentType, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.status {
+			t.Error(c.contentType, c.signed, res.StatusCode)
+		}
+	}
+}
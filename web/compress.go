@@ -0,0 +1,341 @@
+package web
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const _COMPRESS_MIN_SIZE = 1024
+
+var defaultCompressTypes = []string{
+	"text/html",
+	"text/plain",
+	"text/css",
+	"text/xml",
+	"text/javascript",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+type CompressOptions struct {
+	// Level is the level of compress/flate, from 1 (BestSpeed) to 9 (BestCompression),
+	// 0 means the default level.
+	Level int
+	// MinSize is the smallest response compressed, default 1KB
+	MinSize int
+	// Types are the content types compressed, such as application/json,
+	// a trailing "*" matches the prefix like "text/*". Default the common text types.
+	Types []string
+}
+
+// Compress compresses responses with gzip or deflate negotiated from Accept-Encoding.
+// Responses smaller than MinSize, with other content types, already encoded, or partial are not compressed.
+// Responses flushed before MinSize, such as streams, are compressed if their types are allowed.
+// c.ResponseSize() and the bodies captured by AccessLog are the uncompressed ones.
+func Compress(opts CompressOptions) HandlerFunc {
+	if opts.Level == 0 {
+		opts.Level = flate.DefaultCompression
+	}
+	if opts.Level < flate.HuffmanOnly || opts.Level > flate.BestCompression {
+		panic("compress level invalid " + strconv.Itoa(opts.Level))
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = _COMPRESS_MIN_SIZE
+	}
+	if len(opts.Types) < 1 {
+		opts.Types = defaultCompressTypes
+	}
+	gzipPool := &sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(io.Discard, opts.Level)
+		return w
+	}}
+	flatePool := &sync.Pool{New: func() interface{} {
+		w, _ := flate.NewWriter(io.Discard, opts.Level)
+		return w
+	}}
+
+	return func(c *Context) {
+		header := c.ResponseWriter.Header()
+		addVary(header, "Accept-Encoding")
+		encoding := acceptEncoding(c.Request.Header.Get("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		// compress below the writer of context, so status and size are still recorded
+		var raw http.ResponseWriter
+		if c.writer != nil {
+			raw = c.writer.ResponseWriter
+		} else {
+			raw = c.ResponseWriter
+		}
+		cw := &compressWriter{ResponseWriter: raw, encoding: encoding, opts: &opts}
+		cw.pool = gzipPool
+		if encoding == "deflate" {
+			cw.pool = flatePool
+		}
+		if c.writer != nil {
+			c.writer.ResponseWriter = cw
+		} else {
+			c.ResponseWriter = cw
+		}
+		defer func() {
+			cw.close()
+			if c.writer != nil {
+				c.writer.ResponseWriter = raw
+			} else {
+				c.ResponseWriter = raw
+			}
+		}()
+		c.Next()
+	}
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	opts     *CompressOptions
+	pool     *sync.Pool
+
+	status   int
+	buf      []byte
+	decided  bool
+	encoder  io.WriteCloser
+	hijacked bool
+}
+
+type flusher interface {
+	Flush() error
+}
+
+func (this *compressWriter) WriteHeader(status int) {
+	if this.decided {
+		this.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if status >= 100 && status < 200 {
+		this.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if this.status != 0 {
+		return
+	}
+	// delayed until the body decides whether to compress
+	this.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent {
+		this.decide(false)
+	}
+}
+
+func (this *compressWriter) Write(b []byte) (int, error) {
+	if this.decided {
+		return this.write(b)
+	}
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+	header := this.Header()
+	if (header.Get("Content-Type") != "" || header.Get("Content-Encoding") != "") && !this.compressible(nil) {
+		this.decide(false)
+		return this.write(b)
+	}
+	this.buf = append(this.buf, b...)
+	if len(this.buf) < this.opts.MinSize {
+		return len(b), nil
+	}
+	if _, err := this.flushBuffer(true); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush compresses a stream whose type is allowed, though it is smaller than MinSize
+func (this *compressWriter) Flush() {
+	this.FlushError()
+}
+
+// FlushError is used by http.ResponseController,
+// it returns http.ErrNotSupported if the wrapped writer can not flush.
+func (this *compressWriter) FlushError() error {
+	if !this.decided {
+		if this.status == 0 {
+			this.status = http.StatusOK
+		}
+		if _, err := this.flushBuffer(true); err != nil {
+			return err
+		}
+	}
+	if f, ok := this.encoder.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return flushWriter(this.ResponseWriter)
+}
+
+func (this *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := this.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		this.hijacked = true
+	}
+	return conn, rw, err
+}
+
+func (this *compressWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := this.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (this *compressWriter) Unwrap() http.ResponseWriter {
+	return this.ResponseWriter
+}
+
+// flushBuffer decides by the buffered body, then writes it
+func (this *compressWriter) flushBuffer(compress bool) (int, error) {
+	buf := this.buf
+	this.buf = nil
+	this.decide(compress && this.compressible(buf))
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	return this.write(buf)
+}
+
+func (this *compressWriter) write(b []byte) (int, error) {
+	if this.encoder != nil {
+		return this.encoder.Write(b)
+	}
+	return this.ResponseWriter.Write(b)
+}
+
+// compressible checks the headers, the content type is sniffed from sample if it is not set
+func (this *compressWriter) compressible(sample []byte) bool {
+	header := this.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		if len(sample) == 0 {
+			return false
+		}
+		// the same as net/http does on the first write
+		contentType = http.DetectContentType(sample)
+		header.Set("Content-Type", contentType)
+	}
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, t := range this.opts.Types {
+		if strings.HasSuffix(t, "*") && strings.HasPrefix(contentType, t[:len(t)-1]) || contentType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// decide writes the header, then the body goes to the encoder or directly
+func (this *compressWriter) decide(compress bool) {
+	this.decided = true
+	if compress {
+		header := this.Header()
+		header.Set("Content-Encoding", this.encoding)
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		encoder := this.pool.Get().(io.WriteCloser)
+		switch e := encoder.(type) {
+		case *gzip.Writer:
+			e.Reset(this.ResponseWriter)
+		case *flate.Writer:
+			e.Reset(this.ResponseWriter)
+		}
+		this.encoder = encoder
+	}
+	if this.status != 0 {
+		this.ResponseWriter.WriteHeader(this.status)
+	}
+}
+
+func (this *compressWriter) close() {
+	if this.hijacked {
+		return
+	}
+	if !this.decided {
+		if this.status == 0 && len(this.buf) == 0 {
+			// nothing is written
+			this.decided = true
+			return
+		}
+		// smaller than MinSize
+		if len(this.buf) > 0 && this.Header().Get("Content-Length") == "" {
+			this.Header().Set("Content-Length", strconv.Itoa(len(this.buf)))
+		}
+		this.flushBuffer(false)
+		return
+	}
+	if this.encoder != nil {
+		this.encoder.Close()
+		this.pool.Put(this.encoder)
+		this.encoder = nil
+	}
+}
+
+// acceptEncoding chooses gzip or deflate by q-values, gzip is preferred
+func acceptEncoding(accept string) string {
+	listed := map[string]bool{}
+	for _, part := range strings.Split(accept, ",") {
+		listed[strings.ToLower(strings.TrimSpace(strings.Split(part, ";")[0]))] = true
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if name == "*" && !listed["gzip"] {
+			name = "gzip"
+		}
+		if name != "gzip" && name != "deflate" || q <= 0 {
+			continue
+		}
+		if q > bestQ || q == bestQ && name == "gzip" {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+func addVary(header http.Header, value string) {
+	for _, vary := range header.Values("Vary") {
+		for _, v := range strings.Split(vary, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
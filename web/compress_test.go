@@ -0,0 +1,132 @@
+package web
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	s := New("")
+	sizes := make(chan int64, 1)
+	s.Use(func(c *Context) {
+		c.Next()
+		sizes <- c.ResponseSize()
+	})
+	s.Use(Compress(CompressOptions{Level: gzip.BestSpeed, MinSize: 100}))
+	large := strings.Repeat("kelp ", 100)
+	s.GET("/json", func(c *Context) {
+		c.Json(large)
+	})
+	s.GET("/small", func(c *Context) {
+		c.Text("small")
+	})
+	s.GET("/png", func(c *Context) {
+		c.Data("image/png", []byte(large))
+	})
+	s.GET("/sniff", func(c *Context) {
+		c.ResponseWriter.Write([]byte("<html><body>" + large + "</body></html>"))
+	})
+	s.GET("/stream", func(c *Context) {
+		c.ResponseWriter.Header().Set("Content-Type", "text/plain")
+		for i := 0; i < 3; i++ {
+			c.ResponseWriter.Write([]byte("chunk\n"))
+			c.ResponseWriter.(http.Flusher).Flush()
+		}
+	})
+	s.GET("/empty", func(c *Context) {
+		c.DieWithHttpStatus(204)
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	cases := []struct {
+		path     string
+		accept   string
+		encoding string
+		body     string
+	}{
+		{"/json", "gzip, deflate", "gzip", `"` + large + `"`},
+		{"/json", "deflate;q=1, gzip;q=0.5", "deflate", `"` + large + `"`},
+		{"/json", "gzip;q=0, *", "", `"` + large + `"`},
+		{"/json", "", "", `"` + large + `"`},
+		{"/small", "gzip", "", "small"},
+		{"/png", "gzip", "", large},
+		{"/sniff", "gzip", "gzip", "<html><body>" + large + "</body></html>"},
+		{"/stream", "gzip", "gzip", "chunk\nchunk\nchunk\n"},
+		{"/empty", "gzip", "", ""},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest("GET", ts.URL+tc.path, nil)
+		// disable the transparent decompression of http.Transport
+		req.Header.Set("Accept-Encoding", tc.accept)
+		if tc.accept == "" {
+			req.Header.Set("Accept-Encoding", "identity")
+		}
+		res, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reader io.Reader = res.Body
+		switch res.Header.Get("Content-Encoding") {
+		case "gzip":
+			reader, err = gzip.NewReader(res.Body)
+		case "deflate":
+			reader = flate.NewReader(res.Body)
+		}
+		if err != nil {
+			t.Fatal(tc.path, err)
+		}
+		body, _ := ioutil.ReadAll(reader)
+		res.Body.Close()
+		size := <-sizes
+		if res.Header.Get("Content-Encoding") != tc.encoding || string(body) != tc.body {
+			t.Error(tc.path, tc.accept, res.Header, string(body))
+		}
+		if res.Header.Get("Vary") != "Accept-Encoding" {
+			t.Error(tc.path, res.Header)
+		}
+		// the uncompressed size is recorded
+		if size != int64(len(tc.body)) {
+			t.Error(tc.path, size)
+		}
+	}
+}
+
+func TestCompressStream(t *testing.T) {
+	s := New("")
+	s.Use(Compress(CompressOptions{}))
+	next := make(chan struct{})
+	s.GET("/stream", func(c *Context) {
+		c.ResponseWriter.Header().Set("Content-Type", "text/plain")
+		c.ResponseWriter.Write([]byte("first\n"))
+		c.ResponseWriter.(http.Flusher).Flush()
+		<-next
+		c.ResponseWriter.Write([]byte("second\n"))
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	gz, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first line arrives before the handler returns
+	line, err := bufio.NewReader(gz).ReadString('\n')
+	if line != "first\n" {
+		t.Error(line, err)
+	}
+	close(next)
+}
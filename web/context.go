@@ -1,48 +1,83 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"math"
 	"net/http"
-	"strings"
 	"sync"
+	"time"
+
+	"git.lcgc.work/platform/kelp/requestid"
 )
 
+const _ABORT_INDEX = math.MaxInt32
+
 type Context struct {
 	Request        *http.Request
 	ResponseWriter http.ResponseWriter
 
-	Body []byte
+	// Body of json requests is read before handlers, other bodies are read by RawBody
+	Body     []byte
+	bodyRead bool
+	bodyErr  error
 
 	MetaData     map[string]interface{}
 	Params       Params
 	handlerIndex int
 	handlerChain []HandlerFunc
 
-	Response   []byte
-	Status     int
-	HttpStatus int
+	Response []byte
+	// ResponseStatus is the status in the body of Success and Error, HttpStatus is the one of http
+	ResponseStatus int
+	HttpStatus     int
 
 	metaInternal *sync.Map
+	server       *Server
+	writer       *responseWriter
 }
 
 func newContext(w http.ResponseWriter, req *http.Request) *Context {
 	c := &Context{
-		Request:        req,
-		ResponseWriter: w,
-		MetaData:       make(map[string]interface{}),
-		metaInternal:   new(sync.Map),
-	}
-	v := req.Header.Get("Content-Type")
-	if strings.Contains(v, "application/json") {
-		// 如果是json的请求，就把body读出来
-		body, _ := ioutil.ReadAll(req.Body)
-		c.Body = body
+		Request:      req,
+		MetaData:     make(map[string]interface{}),
+		metaInternal: new(sync.Map),
 	}
+	c.writer = newResponseWriter(w, &c.HttpStatus)
+	c.ResponseWriter = c.writer
 	return c
 }
 
+// Context is the context of request, pass it to database and rpc calls
+func (this *Context) Context() context.Context {
+	return this.Request.Context()
+}
+
+// Context implements context.Context by the context of request,
+// so it can be passed to database and rpc calls directly.
+// It is done when the client goes away or the deadline set by Timeout is exceeded.
+func (this *Context) Deadline() (time.Time, bool) {
+	return this.Request.Context().Deadline()
+}
+
+func (this *Context) Done() <-chan struct{} {
+	return this.Request.Context().Done()
+}
+
+func (this *Context) Err() error {
+	return this.Request.Context().Err()
+}
+
+func (this *Context) Value(key interface{}) interface{} {
+	return this.Request.Context().Value(key)
+}
+
+// RequestId is the request id set by RequestId handler
+func (this *Context) RequestId() string {
+	return requestid.FromContext(this.Request.Context())
+}
+
 func (this *Context) Path() string {
 	return this.Request.URL.Path
 }
@@ -133,30 +168,84 @@ func (this *Context) Next() {
 	}
 }
 
+// Abort stops calling the rest handlers in chain,
+// the handlers already called still go on after their Next returns.
+func (this *Context) Abort() {
+	this.handlerIndex = _ABORT_INDEX
+}
+
+func (this *Context) IsAborted() bool {
+	return this.handlerIndex >= _ABORT_INDEX
+}
+
+func (this *Context) AbortWithStatus(status int) {
+	this.DieWithHttpStatus(status)
+	this.Abort()
+}
+
+func (this *Context) AbortWithJSON(status int, data interface{}) {
+	this.jsonWithStatus(status, data)
+	this.Abort()
+}
+
 func (this *Context) Text(msg ...interface{}) {
-	this.ResponseWriter.Header().Add("Content-Type", "text/plain;charset=UTF-8")
-	this.ResponseWriter.Write([]byte(fmt.Sprint(msg...)))
+	this.RenderText(msg...)
+}
+
+// RenderText is Text returning the error of writing
+func (this *Context) RenderText(msg ...interface{}) error {
+	return this.render(this.statusOr(200), "text/plain; charset=utf-8", []byte(fmt.Sprint(msg...)))
 }
 
 func (this *Context) Json(data interface{}) {
-	this.HttpStatus = 200
-	this.ResponseWriter.Header().Add("Content-Type", "text/json;charset=UTF-8")
-	out, _ := json.Marshal(data)
+	this.RenderJson(data)
+}
+
+// RenderJson is Json returning the error of marshaling or writing
+func (this *Context) RenderJson(data interface{}) error {
+	return this.jsonWithStatus(this.statusOr(200), data)
+}
+
+func (this *Context) jsonWithStatus(status int, data interface{}) error {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return this.renderFailed("json", err)
+	}
 	this.Response = out
-	this.ResponseWriter.Write(out)
+	return this.render(status, "application/json; charset=utf-8", out)
 }
 
 func (this *Context) Success(data interface{}) {
-	this.Status = 0
+	this.RenderSuccess(data)
+}
+
+// RenderSuccess is Success returning the error of marshaling or writing
+func (this *Context) RenderSuccess(data interface{}) error {
+	this.ResponseStatus = 0
 	resp := map[string]interface{}{
 		"status": 0,
 		"data":   data,
 	}
-	this.Json(resp)
+	return this.RenderJson(resp)
 }
 
 func (this *Context) Error(status int, message interface{}) {
-	this.Status = status
+	this.RenderError(status, message)
+}
+
+// RenderError is Error returning the error of marshaling or writing
+func (this *Context) RenderError(status int, message interface{}) error {
+	return this.RenderErrorWithHttpStatus(this.statusOr(200), status, message)
+}
+
+// ErrorWithHttpStatus responds the same body as Error with http status
+func (this *Context) ErrorWithHttpStatus(httpStatus int, status int, message interface{}) {
+	this.RenderErrorWithHttpStatus(httpStatus, status, message)
+}
+
+// RenderErrorWithHttpStatus is ErrorWithHttpStatus returning the error of marshaling or writing
+func (this *Context) RenderErrorWithHttpStatus(httpStatus int, status int, message interface{}) error {
+	this.ResponseStatus = status
 	resp := map[string]interface{}{
 		"status": status,
 	}
@@ -166,7 +255,7 @@ func (this *Context) Error(status int, message interface{}) {
 	default:
 		resp["message"] = ret
 	}
-	this.Json(resp)
+	return this.jsonWithStatus(httpStatus, resp)
 }
 
 func (this *Context) DieWithHttpStatus(status int) {
@@ -0,0 +1,159 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultCORSMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+type CORSOptions struct {
+	// AllowOrigins are exact origins like "https://example.com",
+	// wildcard subdomains like "https://*.example.com", or "*" for any origin.
+	AllowOrigins []string
+	// AllowOriginFunc is checked if the origin is not in AllowOrigins
+	AllowOriginFunc func(origin string) bool
+	// AllowMethods default GET, HEAD, POST, PUT, PATCH and DELETE
+	AllowMethods []string
+	// AllowHeaders default the headers asked by the preflight
+	AllowHeaders  []string
+	ExposeHeaders []string
+	// AllowCredentials can not be used with "*" in AllowOrigins
+	AllowCredentials bool
+	// MaxAge is how long the preflight is cached by browsers, 0 means not sent
+	MaxAge time.Duration
+}
+
+// CORS uses the CORS middleware on the router, and registers it for automatic preflights.
+// Preflights are answered even if there is no OPTIONS router, only the CORS of routers above runs for them,
+// other middleware such as auth or rate limit does not.
+func (this *Router) CORS(opts CORSOptions) *Router {
+	handler := CORS(opts)
+	this.cors = append(this.cors, handler)
+	return this.Use(handler)
+}
+
+// corsChain returns the CORS registered by the routers from the root to this one
+func (this *Router) corsChain() []HandlerFunc {
+	chain := []HandlerFunc{}
+	for router := this; router != nil; router = router.parent {
+		chain = append(append([]HandlerFunc{}, router.cors...), chain...)
+	}
+	return chain
+}
+
+// CORS answers preflights and adds CORS headers to responses of allowed origins.
+// A preflight from an origin not allowed is responded 403.
+// Use it by Router.CORS, so automatic preflights run only it. If it is used by Use,
+// such as wrapped by other middleware, automatic preflights run the whole middleware of the router.
+//
+//	server.CORS(web.CORSOptions{
+//		AllowOrigins:     []string{"https://example.com", "https://*.example.com"},
+//		AllowHeaders:     []string{"Content-Type", "Authorization"},
+//		AllowCredentials: true,
+//		MaxAge:           12 * time.Hour,
+//	})
+func CORS(opts CORSOptions) HandlerFunc {
+	allowAny := false
+	for _, origin := range opts.AllowOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+	}
+	if allowAny && opts.AllowCredentials {
+		// any site could make credentialed requests
+		panic("cors: AllowOrigins \"*\" can not be used with AllowCredentials")
+	}
+	methods := opts.AllowMethods
+	if len(methods) < 1 {
+		methods = defaultCORSMethods
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(opts.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(opts.ExposeHeaders, ", ")
+	maxAge := ""
+	if opts.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(opts.MaxAge / time.Second))
+	}
+
+	return func(c *Context) {
+		origin := c.Request.Header.Get("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		header := c.ResponseWriter.Header()
+		preflight := c.Request.Method == http.MethodOptions &&
+			c.Request.Header.Get("Access-Control-Request-Method") != ""
+		if !allowAny {
+			// the response differs by origin
+			header.Add("Vary", "Origin")
+		}
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if !allowAny && !corsOriginAllowed(origin, opts) {
+			if preflight {
+				c.AbortWithStatus(403)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if allowAny {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if opts.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", allowMethods)
+		if allowHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowHeaders)
+		} else if requested := c.Request.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if maxAge != "" {
+			header.Set("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(204)
+	}
+}
+
+func corsOriginAllowed(origin string, opts CORSOptions) bool {
+	for _, allowed := range opts.AllowOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// https://*.example.com matches https://a.example.com and https://a.b.example.com
+		if i := strings.Index(allowed, "*"); i >= 0 {
+			prefix, suffix := strings.ToLower(allowed[:i]), strings.ToLower(allowed[i+1:])
+			o := strings.ToLower(origin)
+			if len(o) > len(prefix)+len(suffix) && strings.HasPrefix(o, prefix) && strings.HasSuffix(o, suffix) &&
+				!strings.ContainsAny(o[len(prefix):len(o)-len(suffix)], "/:") {
+				return true
+			}
+		}
+	}
+	return opts.AllowOriginFunc != nil && opts.AllowOriginFunc(origin)
+}
@@ -0,0 +1,151 @@
+package web
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	s := New("")
+	quota := 0
+	s.Use(func(c *Context) {
+		// such as rate limit
+		quota++
+		c.Next()
+	})
+	api := s.Group("/api")
+	api.CORS(CORSOptions{
+		AllowOrigins:     []string{"https://example.com", "https://*.example.org"},
+		AllowOriginFunc:  func(origin string) bool { return strings.HasSuffix(origin, ".test") },
+		AllowHeaders:     []string{"Content-Type", "Authorization"},
+		ExposeHeaders:    []string{"X-Request-Id"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	})
+	api.Use(func(c *Context) {
+		// such as auth, preflights do not have credentials
+		if c.Request.Header.Get("Origin") != "" && c.Request.Method != "PUT" {
+			c.AbortWithStatus(401)
+			return
+		}
+		c.Next()
+	})
+	api.PUT("/user/:id", func(c *Context) {
+		c.Text("ok")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	cases := []struct {
+		method string
+		origin string
+		status int
+		allow  string
+	}{
+		{"OPTIONS", "https://example.com", 204, "https://example.com"},
+		{"OPTIONS", "https://a.b.example.org", 204, "https://a.b.example.org"},
+		{"OPTIONS", "http://dev.test", 204, "http://dev.test"},
+		{"OPTIONS", "https://example.org", 403, ""},
+		{"OPTIONS", "https://evil.com", 403, ""},
+		{"PUT", "https://example.com", 200, "https://example.com"},
+		{"PUT", "https://evil.com", 200, ""},
+		{"PUT", "", 200, ""},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, ts.URL+"/api/user/1", nil)
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if tc.method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "PUT")
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.status || res.Header.Get("Access-Control-Allow-Origin") != tc.allow {
+			t.Error(tc.method, tc.origin, res.StatusCode, res.Header)
+			continue
+		}
+		if tc.allow == "" {
+			continue
+		}
+		if res.Header.Get("Access-Control-Allow-Credentials") != "true" {
+			t.Error(res.Header)
+		}
+		if tc.method == "OPTIONS" && (res.Header.Get("Access-Control-Allow-Headers") != "Content-Type, Authorization" ||
+			res.Header.Get("Access-Control-Max-Age") != "3600" ||
+			!strings.Contains(res.Header.Get("Access-Control-Allow-Methods"), "PUT")) {
+			t.Error(res.Header)
+		}
+		if tc.method == "PUT" && res.Header.Get("Access-Control-Expose-Headers") != "X-Request-Id" {
+			t.Error(res.Header)
+		}
+	}
+
+	// only CORS runs for preflights
+	if quota != 3 {
+		t.Error("middleware run for preflights", quota)
+	}
+
+	// any origin without credentials, a preflight to a path without router
+	s = New("")
+	s.CORS(CORSOptions{AllowOrigins: []string{"*"}})
+	ts2 := s.RunTest()
+	defer ts2.Close()
+	req, _ := http.NewRequest("OPTIONS", ts2.URL+"/none", nil)
+	req.Header.Set("Origin", "https://any.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 204 || res.Header.Get("Access-Control-Allow-Origin") != "*" || res.Header.Get("Access-Control-Allow-Headers") != "X-Custom" {
+		t.Error(res.StatusCode, res.Header)
+	}
+}
+
+func TestCORSWrapped(t *testing.T) {
+	s := New("")
+	cors := CORS(CORSOptions{AllowOrigins: []string{"https://example.com"}})
+	// CORS wrapped by the user's own middleware is not registered
+	s.Use(func(c *Context) {
+		if !strings.HasPrefix(c.Request.URL.Path, "/internal") {
+			cors(c)
+			return
+		}
+		c.Next()
+	})
+	s.DELETE("/user/:id", func(c *Context) {
+		c.Text("ok")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	req, _ := http.NewRequest("OPTIONS", ts.URL+"/user/1", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "DELETE")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 204 || res.Header.Get("Access-Control-Allow-Origin") != "https://example.com" ||
+		!strings.Contains(res.Header.Get("Access-Control-Allow-Methods"), "DELETE") {
+		t.Error(res.StatusCode, res.Header)
+	}
+}
+
+func TestCORSAnyWithCredentials(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("\"*\" with credentials is accepted")
+		}
+	}()
+	CORS(CORSOptions{AllowOrigins: []string{"*"}, AllowCredentials: true})
+}
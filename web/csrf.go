@@ -0,0 +1,159 @@
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+const (
+	_CSRF_HEADER      = "X-CSRF-Token"
+	_CSRF_FORM_FIELD  = "_csrf"
+	_CSRF_SESSION_KEY = "_csrf"
+	_CSRF_COOKIE      = "csrf_token"
+	_CSRF_META_KEY    = "csrf_token"
+	_CSRF_TOKEN_BYTES = 32
+)
+
+type CSRFOptions struct {
+	// HeaderName is where the token is sent by scripts, default "X-CSRF-Token"
+	HeaderName string
+	// FormField is where the token is sent by forms, default "_csrf"
+	FormField string
+	// SessionKey is where the token is stored in session, default "_csrf"
+	SessionKey string
+
+	// DoubleSubmit keeps the token in a cookie instead of session,
+	// the token sent should be the same as the cookie.
+	DoubleSubmit bool
+	// CookieName of the double submit cookie, default "csrf_token".
+	// It is not HttpOnly, so scripts can read it and send it in the header.
+	CookieName string
+	// CookieSecure sends the cookie only by https, it is always secure if the request is https
+	CookieSecure bool
+
+	// SkipPaths are not checked, such as webhooks, a trailing "*" matches the prefix
+	SkipPaths []string
+}
+
+// CSRF issues a token for each session, and checks it on POST, PUT, PATCH, DELETE and other unsafe methods.
+// The token is sent by the header or the form field, a missing or wrong one is responded 403.
+// The session should be started before it, such as by SessionWithCookieHandler,
+// unless DoubleSubmit is used. Get the token by c.CSRFToken() to render forms.
+//
+//	server.Use(web.SessionWithCookieHandler("sid", time.Hour))
+//	server.Use(web.CSRF(web.CSRFOptions{}))
+func CSRF(opts CSRFOptions) HandlerFunc {
+	if opts.HeaderName == "" {
+		opts.HeaderName = _CSRF_HEADER
+	}
+	if opts.FormField == "" {
+		opts.FormField = _CSRF_FORM_FIELD
+	}
+	if opts.SessionKey == "" {
+		opts.SessionKey = _CSRF_SESSION_KEY
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = _CSRF_COOKIE
+	}
+
+	return func(c *Context) {
+		var token string
+		var err error
+		if opts.DoubleSubmit {
+			token, err = csrfCookieToken(c, opts)
+		} else {
+			token, err = csrfSessionToken(c, opts)
+		}
+		if err != nil {
+			c.Error(-1, err)
+			c.Abort()
+			return
+		}
+		c.metaInternal.Store(_CSRF_META_KEY, token)
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			c.Next()
+			return
+		}
+		if skipPath(c.Request.URL.Path, opts.SkipPaths) {
+			c.Next()
+			return
+		}
+		sent := csrfSentToken(c, opts)
+		if sent == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			log.Warn("csrf token mismatch", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			c.AbortWithStatus(403)
+			return
+		}
+		c.Next()
+	}
+}
+
+// CSRFToken returns the token issued by CSRF, it is empty if CSRF is not used
+func (this *Context) CSRFToken() string {
+	if token, ok := this.metaInternal.Load(_CSRF_META_KEY); ok {
+		return token.(string)
+	}
+	return ""
+}
+
+func csrfSessionToken(c *Context, opts CSRFOptions) (string, error) {
+	value, err := c.GetSession(opts.SessionKey)
+	if err != nil {
+		return "", err
+	}
+	if token, ok := value.(string); ok && token != "" {
+		return token, nil
+	}
+	token, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+	return token, c.SetSession(opts.SessionKey, token)
+}
+
+func csrfCookieToken(c *Context, opts CSRFOptions) (string, error) {
+	if token, err := c.GetCookie(opts.CookieName); err == nil && token != "" {
+		return token, nil
+	}
+	token, err := newCSRFToken()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(c.ResponseWriter, &http.Cookie{
+		Name:     opts.CookieName,
+		Value:    token,
+		Path:     "/",
+		Secure:   opts.CookieSecure || c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
+
+// csrfSentToken reads the header, then the field of urlencoded or multipart forms
+func csrfSentToken(c *Context, opts CSRFOptions) string {
+	if token := c.Request.Header.Get(opts.HeaderName); token != "" {
+		return token
+	}
+	contentType := strings.ToLower(c.Request.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") &&
+		!strings.HasPrefix(contentType, "multipart/form-data") {
+		return ""
+	}
+	if err := c.parseForm(); err != nil {
+		return ""
+	}
+	return c.Request.PostForm.Get(opts.FormField)
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, _CSRF_TOKEN_BYTES)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSRF(t *testing.T) {
+	s := New("")
+	s.UseMemSession(time.Minute, time.Minute)
+	s.Use(SessionWithCookieHandler("sid", time.Minute))
+	s.Use(CSRF(CSRFOptions{SkipPaths: []string{"/hook/*"}}))
+	s.GET("/form", func(c *Context) {
+		c.Text(c.CSRFToken())
+	})
+	s.POST("/form", func(c *Context) {
+		c.Text("ok")
+	})
+	s.POST("/hook/pay", func(c *Context) {
+		c.Text("ok")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	res, err := client.Get(ts.URL + "/form")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	token := string(body)
+	if len(token) < 32 {
+		t.Fatal("token", token)
+	}
+	// the same token in session
+	res, _ = client.Get(ts.URL + "/form")
+	body, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != token {
+		t.Error("token changed", token, string(body))
+	}
+
+	cases := []struct {
+		path        string
+		header      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"/form", "", "", "", 403},
+		{"/form", token, "", "", 200},
+		{"/form", "wrong", "", "", 403},
+		{"/form", "", "application/x-www-form-urlencoded", url.Values{"_csrf": {token}}.Encode(), 200},
+		{"/form", "", "application/x-www-form-urlencoded", url.Values{"_csrf": {"wrong"}}.Encode(), 403},
+		{"/form", "", "application/json", `{"_csrf":"` + token + `"}`, 403},
+		{"/hook/pay", "", "", "", 200},
+	}
+	for i, tc := range cases {
+		req, _ := http.NewRequest("POST", ts.URL+tc.path, strings.NewReader(tc.body))
+		if tc.header != "" {
+			req.Header.Set("X-CSRF-Token", tc.header)
+		}
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.status {
+			t.Error(i, res.StatusCode)
+		}
+	}
+
+	// a token of another session
+	req, _ := http.NewRequest("POST", ts.URL+"/form", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 403 {
+		t.Error(res.StatusCode)
+	}
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	s := New("")
+	s.Use(CSRF(CSRFOptions{DoubleSubmit: true}))
+	s.GET("/", func(c *Context) {
+		c.Text(c.CSRFToken())
+	})
+	s.DELETE("/", func(c *Context) {
+		c.Text("ok")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	res, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	token := string(body)
+	cookies := res.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "csrf_token" || cookies[0].Value != token || cookies[0].HttpOnly {
+		t.Fatal(cookies)
+	}
+
+	cases := []struct {
+		client *http.Client
+		header string
+		status int
+	}{
+		{client, token, 200},
+		{client, "wrong", 403},
+		{client, "", 403},
+		// without the cookie
+		{http.DefaultClient, token, 403},
+	}
+	for i, tc := range cases {
+		req, _ := http.NewRequest("DELETE", ts.URL, nil)
+		if tc.header != "" {
+			req.Header.Set("X-CSRF-Token", tc.header)
+		}
+		res, err := tc.client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.status {
+			t.Error(i, res.StatusCode)
+		}
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"net"
 	"net/http"
 	"reflect"
-	"strings"
 )
 
 // GRPC can route a http request to a grpcHandler
@@ -23,6 +22,7 @@ import (
 // The error response will return HTTP STATUS
 //   400: invalid param
 //   500: grpc handler returns error
+//   503: the deadline set by Timeout is exceeded
 func (this *Server) GRPC(path string, grpcHandler interface{}) *Router {
 	return this.router.GRPC(path, grpcHandler)
 }
@@ -38,19 +38,21 @@ func buildHandlerFromGrpcHandler(grpcHandler interface{}) HandlerFunc {
 	paramType := handlerType.In(1)
 	return func(c *Context) {
 		param := reflect.New(paramType.Elem()).Interface()
-		if err := json.Unmarshal(c.Body, &param); err != nil {
-			log.Error("grpc param bind error", err, string(c.Body))
+		body, bodyErr := c.RawBody()
+		if bodyErr == ErrBodyTooLarge {
+			// 413 is responded by RawBody
+			return
+		}
+		if err := json.Unmarshal(body, &param); err != nil {
+			log.Error("grpc param bind error", err, string(body))
 			c.DieWithHttpStatus(400)
 			return
 		}
-		ctx := context.Background()
+		// canceled when the client goes away or the deadline set by Timeout is exceeded
+		var ctx context.Context = c.Context()
 		// add peer
-		ip := c.Request.RemoteAddr
-		if index := strings.LastIndex(ip, ":"); index > 0 {
-			ip = ip[:index]
-		}
-		if addr, err := net.ResolveIPAddr("", ip); err == nil {
-			p := &peer.Peer{Addr: addr}
+		if ip := net.ParseIP(c.ClientIP()); ip != nil {
+			p := &peer.Peer{Addr: &net.IPAddr{IP: ip}}
 			ctx = peer.NewContext(ctx, p)
 		}
 
@@ -62,6 +64,10 @@ func buildHandlerFromGrpcHandler(grpcHandler interface{}) HandlerFunc {
 		err := ret[1].Interface()
 		if err != nil {
 			log.Error("grpc deal error", err)
+			if c.Err() == context.DeadlineExceeded {
+				c.DieWithHttpStatus(503)
+				return
+			}
 			c.DieWithHttpStatus(500)
 			return
 		}
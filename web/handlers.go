@@ -1,15 +1,22 @@
 package web
 
 import (
+	"context"
 	"strconv"
-	"strings"
 	"time"
+
+	"git.lcgc.work/platform/kelp/requestid"
 )
 
 func RecoveryHandler(c *Context) {
 	defer func() {
 		if err := recover(); err != nil {
 			log.Error("[panic]", err)
+			c.Abort()
+			if c.server != nil && c.server.panicHandler != nil {
+				c.server.panicHandler(c, err)
+				return
+			}
 			c.DieWithHttpStatus(500)
 		}
 	}()
@@ -23,23 +30,98 @@ func str(v string) string {
 	return v
 }
 
+// RequestId accepts the X-Request-Id header or generates one,
+// it is echoed in the response header and passed in c.Context(), see package requestid.
+func RequestId() HandlerFunc {
+	return func(c *Context) {
+		id := c.Request.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.ResponseWriter.Header().Set(requestid.Header, id)
+		c.Next()
+	}
+}
+
+// Timeout sets a deadline on the request context, c should be passed to blocking calls,
+// such as database and rpc, so they return when the deadline is exceeded.
+// The rest handlers run in another goroutine and their response is buffered,
+// 503 is responded as soon as the deadline is exceeded, like http.TimeoutHandler,
+// and later writes of the handlers return http.ErrHandlerTimeout.
+// Flush and Hijack are not supported after it, so do not use it for SSE or websocket.
+func Timeout(d time.Duration) HandlerFunc {
+	return func(c *Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+
+		tw := newTimeoutWriter(c.ResponseWriter.Header())
+		// the handlers get a copy of c, so fields of c are not shared with them after timeout
+		inner := *c
+		inner.MetaData = make(map[string]interface{}, len(c.MetaData))
+		for k, v := range c.MetaData {
+			inner.MetaData[k] = v
+		}
+		inner.Request = c.Request.WithContext(ctx)
+		inner.writer = newResponseWriter(tw, &inner.HttpStatus)
+		inner.ResponseWriter = inner.writer
+
+		done := make(chan struct{})
+		panicChan := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					// nobody waits for the panic after timeout
+					if !tw.sendPanic(panicChan, p) {
+						log.Error("[panic] after timeout", p)
+					}
+				}
+			}()
+			inner.Next()
+			close(done)
+		}()
+
+		select {
+		case p := <-panicChan:
+			panic(p)
+		case <-done:
+			c.Request = inner.Request
+			c.Body, c.bodyRead, c.bodyErr = inner.Body, inner.bodyRead, inner.bodyErr
+			c.MetaData, c.Params = inner.MetaData, inner.Params
+			c.Response, c.ResponseStatus = inner.Response, inner.ResponseStatus
+			c.handlerIndex = inner.handlerIndex
+			tw.writeTo(c.ResponseWriter)
+			if c.HttpStatus == 0 {
+				c.HttpStatus = inner.HttpStatus
+			}
+		case <-ctx.Done():
+			tw.timeout()
+			// a panic sent before timeout is handled as usual
+			select {
+			case p := <-panicChan:
+				panic(p)
+			default:
+			}
+			c.Abort()
+			if ctx.Err() == context.DeadlineExceeded {
+				c.DieWithHttpStatus(503)
+			}
+		}
+	}
+}
+
+// LogHandler logs the whole request and response bodies,
+// AccessLog is preferred which redacts and truncates them.
 func LogHandler(c *Context) {
 	start := time.Now()
 	path := c.Request.URL.Path
 	raw := c.Request.URL.RawQuery
-	ips := c.Request.Header.Get("X-Forwarded-For")
-	ip := ""
-	if ips != "" {
-		ip = strings.Split(ips, ",")[0]
-	}
-	if ip == "" {
-		ip = c.Request.Header.Get("X-Real-Ip")
-	}
-	if ip == "" {
-		ip = c.Request.RemoteAddr
-	}
+	ip := c.ClientIP()
 
-	traceId := c.Request.Header.Get("trace_id")
+	traceId := c.RequestId()
+	if traceId == "" {
+		traceId = c.Request.Header.Get("trace_id")
+	}
 	uuid := c.Request.Header.Get("uuid")
 
 	c.Next()
@@ -48,6 +130,7 @@ func LogHandler(c *Context) {
 	latency := end.Sub(start)
 	method := c.Request.Method
 	resp := string(c.Response)
+	// the body is logged only if it was read by handlers
 	req := string(c.Body)
 	if raw != "" {
 		path = path + "?" + raw
@@ -63,6 +146,8 @@ func LogHandler(c *Context) {
 		str(uuid),    // uuid
 		str(req),
 		str(resp),
+		c.HttpStatus,
+		c.ResponseSize(),
 	)
 }
 
@@ -74,6 +159,7 @@ func SessionWithCookieHandler(cookieSessionKey string, duration time.Duration) H
 		}
 		if err := c.StartSession(token); err != nil {
 			c.Error(-1, err)
+			c.Abort()
 			return
 		}
 		c.SetCookie(cookieSessionKey, token, duration)
@@ -97,7 +183,7 @@ func TokenAuthorization(token string) HandlerFunc {
 		auth := c.Request.Header.Get("Authorization")
 		if auth != token {
 			log.Error("[authorization failed]", auth)
-			c.DieWithHttpStatus(401)
+			c.AbortWithStatus(401)
 		} else {
 			c.Next()
 		}
@@ -106,20 +192,32 @@ func TokenAuthorization(token string) HandlerFunc {
 
 func SignCheck(sign string) HandlerFunc {
 	return func(c *Context) {
+		// only json bodies are signed, other requests are signed with an empty body
+		var body []byte
+		if isJSONRequest(c.Request) {
+			var err error
+			if body, err = c.RawBody(); err != nil {
+				log.Error("[sign check failed]", err)
+				if err != ErrBodyTooLarge {
+					c.AbortWithStatus(400)
+				}
+				return
+			}
+		}
 		token := c.QueryDefault("token", "")
 		timestamp, err := strconv.ParseInt(c.QueryDefault("timestamp", "0"), 10, 64)
 		if err != nil {
-			c.DieWithHttpStatus(401)
+			c.AbortWithStatus(401)
 			return
 		}
 		if timestamp == 0 {
-			if !Sha1Verify([]byte(sign), c.Body, []byte(token), 5) {
-				c.DieWithHttpStatus(401)
+			if !Sha1Verify([]byte(sign), body, []byte(token), 5) {
+				c.AbortWithStatus(401)
 				return
 			}
 		} else {
-			if !Sha1VerifyTimestamp([]byte(sign), c.Body, []byte(token), 5, timestamp) {
-				c.DieWithHttpStatus(401)
+			if !Sha1VerifyTimestamp([]byte(sign), body, []byte(token), 5, timestamp) {
+				c.AbortWithStatus(401)
 				return
 			}
 		}
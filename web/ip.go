@@ -0,0 +1,192 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const _TRUSTED_UNIX_PROXY = "unix"
+
+// SetTrustedProxies sets the proxies, such as load balancers, whose forwarding headers are honored,
+// by CIDR like "10.0.0.0/8", a single ip like "127.0.0.1", or "unix" for every peer of unix sockets,
+// such as nginx in front of a server listening on "unix:///path/to/app.sock".
+// No proxy is trusted by default, so ClientIP is the peer of the connection.
+func (this *Server) SetTrustedProxies(proxies ...string) error {
+	nets := []*net.IPNet{}
+	trustUnix := false
+	for _, proxy := range proxies {
+		if proxy == _TRUSTED_UNIX_PROXY {
+			trustUnix = true
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			proxy = fmt.Sprintf("%s/%d", ip, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %v", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	this.trustedProxies = nets
+	this.trustUnixProxy = trustUnix
+	return nil
+}
+
+// ClientIP is the ip of the client. The headers Forwarded, X-Forwarded-For and X-Real-Ip are
+// honored in order only if the request comes from a trusted proxy, see Server.SetTrustedProxies.
+// The hops in them are checked from right to left, the first one not trusted is the client.
+func (this *Context) ClientIP() string {
+	remote := remoteIP(this.Request.RemoteAddr)
+	if !this.isTrustedPeer() {
+		return remote
+	}
+	header := this.Request.Header
+	if hops := forwardedFor(header.Values("Forwarded")); len(hops) > 0 {
+		if ip, ok := this.clientFromHops(hops); ok {
+			return ip
+		}
+	}
+	if hops := splitHops(header.Values("X-Forwarded-For")); len(hops) > 0 {
+		if ip, ok := this.clientFromHops(hops); ok {
+			return ip
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(header.Get("X-Real-Ip"))); ip != nil {
+		return ip.String()
+	}
+	return remote
+}
+
+// Scheme is "https" or "http" of the client. The headers Forwarded and X-Forwarded-Proto are
+// honored in order only if the request comes from a trusted proxy, see Server.SetTrustedProxies.
+// The first proto in them is the one of the proxy facing the client.
+func (this *Context) Scheme() string {
+	if this.Request.TLS != nil {
+		return "https"
+	}
+	if !this.isTrustedPeer() {
+		return "http"
+	}
+	header := this.Request.Header
+	if proto := forwardedProto(header.Values("Forwarded")); proto != "" {
+		return proto
+	}
+	if hops := splitHops(header.Values("X-Forwarded-Proto")); len(hops) > 0 {
+		if proto := strings.ToLower(hops[0]); proto == "https" || proto == "http" {
+			return proto
+		}
+	}
+	return "http"
+}
+
+// isTrustedPeer reports whether the peer of the connection is a trusted proxy,
+// the peer of a unix socket has no ip, its RemoteAddr is like "@".
+func (this *Context) isTrustedPeer() bool {
+	if addr, ok := this.Request.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		return this.server != nil && this.server.trustUnixProxy
+	}
+	return this.isTrustedProxy(remoteIP(this.Request.RemoteAddr))
+}
+
+func (this *Context) isTrustedProxy(ip string) bool {
+	if this.server == nil {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range this.server.trustedProxies {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientFromHops is false if any hop is invalid, then the header is ignored
+func (this *Context) clientFromHops(hops []string) (string, bool) {
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			return "", false
+		}
+		if i == 0 || !this.isTrustedProxy(ip.String()) {
+			return ip.String(), true
+		}
+	}
+	return "", false
+}
+
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+func splitHops(values []string) []string {
+	hops := []string{}
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// forwardedFor parses the "for" of RFC 7239 like:
+//
+//	Forwarded: for=192.0.2.43, for="[2001:db8:cafe::17]:4711";proto=https
+func forwardedFor(values []string) []string {
+	hops := []string{}
+	for _, element := range splitHops(values) {
+		for _, pair := range strings.Split(element, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 || !strings.EqualFold(kv[0], "for") {
+				continue
+			}
+			node := strings.Trim(kv[1], `"`)
+			if strings.HasPrefix(node, "[") {
+				// [ipv6] or [ipv6]:port
+				if end := strings.IndexByte(node, ']'); end > 0 {
+					node = node[1:end]
+				}
+			} else if host, _, err := net.SplitHostPort(node); err == nil {
+				node = host
+			}
+			// "unknown" and obfuscated identifiers are kept and make the header ignored
+			hops = append(hops, node)
+		}
+	}
+	return hops
+}
+
+// forwardedProto is the first "proto" of RFC 7239, empty if it is not http or https
+func forwardedProto(values []string) string {
+	for _, element := range splitHops(values) {
+		for _, pair := range strings.Split(element, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 || !strings.EqualFold(kv[0], "proto") {
+				continue
+			}
+			if proto := strings.ToLower(strings.Trim(kv[1], `"`)); proto == "https" || proto == "http" {
+				return proto
+			}
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	s := New("")
+	if err := s.SetTrustedProxies("10.0.0.0/8", "127.0.0.1", "::1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTrustedProxies("10.0.0.0/8", "proxy"); err == nil {
+		t.Error("invalid proxy is accepted")
+	}
+	s.SetTrustedProxies("10.0.0.0/8", "127.0.0.1", "::1")
+
+	cases := []struct {
+		remote string
+		header map[string]string
+		expect string
+	}{
+		{"1.2.3.4:1234", nil, "1.2.3.4"},
+		// not from a trusted proxy
+		{"1.2.3.4:1234", map[string]string{"X-Forwarded-For": "5.6.7.8"}, "1.2.3.4"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "5.6.7.8"}, "5.6.7.8"},
+		// the spoofed first hop is ignored
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "9.9.9.9, 5.6.7.8, 10.0.0.2"}, "5.6.7.8"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "garbage", "X-Real-Ip": "5.6.7.8"}, "5.6.7.8"},
+		{"10.0.0.1:1234", map[string]string{"X-Real-Ip": "5.6.7.8"}, "5.6.7.8"},
+		{"[::1]:1234", map[string]string{"Forwarded": `for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"127.0.0.1:1234", map[string]string{"Forwarded": "for=192.0.2.60:80;by=10.0.0.2", "X-Forwarded-For": "5.6.7.8"}, "192.0.2.60"},
+		{"127.0.0.1:1234", map[string]string{"Forwarded": "for=unknown", "X-Forwarded-For": "5.6.7.8"}, "5.6.7.8"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remote
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		c := newContext(httptest.NewRecorder(), req)
+		c.server = s
+		if ip := c.ClientIP(); ip != tc.expect {
+			t.Error(tc.remote, tc.header, ip)
+		}
+	}
+}
+
+func TestScheme(t *testing.T) {
+	s := New("")
+	s.SetTrustedProxies("10.0.0.0/8")
+
+	cases := []struct {
+		remote string
+		header map[string]string
+		expect string
+	}{
+		{"1.2.3.4:1234", nil, "http"},
+		// not from a trusted proxy
+		{"1.2.3.4:1234", map[string]string{"X-Forwarded-Proto": "https"}, "http"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-Proto": "https"}, "https"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-Proto": "HTTPS, http"}, "https"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-Proto": "ftp"}, "http"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `for=1.2.3.4;proto="https", for=10.0.0.2;proto=http`}, "https"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": "for=1.2.3.4;proto=http", "X-Forwarded-Proto": "https"}, "http"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remote
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		c := newContext(httptest.NewRecorder(), req)
+		c.server = s
+		if scheme := c.Scheme(); scheme != tc.expect {
+			t.Error(tc.remote, tc.header, scheme)
+		}
+	}
+}
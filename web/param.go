@@ -0,0 +1,104 @@
+package web
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A path param can be constrained like:
+//
+//	:id<int>         registered param type, see RegisterParamType
+//	:slug<[a-z-]+>   regular expression which should match the whole segment
+//
+// A segment which fails the constraint falls through to the next router.
+type ParamTypeFunc func(string) bool
+
+var paramTypes map[string]ParamTypeFunc
+
+func init() {
+	paramTypes = make(map[string]ParamTypeFunc)
+	paramTypes["int"] = func(s string) bool {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	}
+	paramTypes["uint"] = func(s string) bool {
+		_, err := strconv.ParseUint(s, 10, 64)
+		return err == nil
+	}
+	paramTypes["uuid"] = regexp.MustCompile(
+		"^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$",
+	).MatchString
+	paramTypes["alpha"] = regexp.MustCompile("^[a-zA-Z]+$").MatchString
+}
+
+// RegisterParamType should be called before adding routers which use it
+func RegisterParamType(name string, f ParamTypeFunc) {
+	paramTypes[name] = f
+}
+
+// parseParam splits a param segment like ":id<int>" without the leading ':'
+func parseParam(segment string) (name string, constraint string, match ParamTypeFunc, err error) {
+	name = segment
+	if i := strings.IndexByte(segment, '<'); i >= 0 {
+		if segment[len(segment)-1] != '>' {
+			return "", "", nil, fmt.Errorf("invalid param constraint %q", segment)
+		}
+		name = segment[:i]
+		constraint = segment[i+1 : len(segment)-1]
+		if constraint == "" {
+			return "", "", nil, fmt.Errorf("empty param constraint %q", segment)
+		}
+		if f, ok := paramTypes[constraint]; ok {
+			match = f
+		} else {
+			reg, err := regexp.Compile("^(?:" + constraint + ")$")
+			if err != nil {
+				return "", "", nil, fmt.Errorf("invalid param constraint %q: %v", segment, err)
+			}
+			match = reg.MatchString
+		}
+	}
+	if name == "" || strings.ContainsAny(name, ":*<>") {
+		return "", "", nil, fmt.Errorf("invalid param %q", segment)
+	}
+	return name, constraint, match, nil
+}
+
+func (this *Context) ParamInt(key string) (int, error) {
+	value, err := this.ParamInt64(key)
+	return int(value), err
+}
+
+func (this *Context) ParamInt64(key string) (int64, error) {
+	value, ok := this.Param(key)
+	if !ok {
+		return 0, fmt.Errorf("param %s not found", key)
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func (this *Context) ParamUint64(key string) (uint64, error) {
+	value, ok := this.Param(key)
+	if !ok {
+		return 0, fmt.Errorf("param %s not found", key)
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func (this *Context) ParamFloat64(key string) (float64, error) {
+	value, ok := this.Param(key)
+	if !ok {
+		return 0, fmt.Errorf("param %s not found", key)
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func (this *Context) ParamBool(key string) (bool, error) {
+	value, ok := this.Param(key)
+	if !ok {
+		return false, fmt.Errorf("param %s not found", key)
+	}
+	return strconv.ParseBool(value)
+}
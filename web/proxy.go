@@ -2,6 +2,9 @@ package web
 
 const (
 	HTTP_PROXY_METHOD = "PROXY"
+
+	// the catch-all param name which holds the path below a proxy router
+	_PROXY_PATH_PARAM = "proxy_path"
 )
 
 func (this *Server) PROXY(path string, handlers ...HandlerFunc) *Router {
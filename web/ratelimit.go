@@ -0,0 +1,361 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitTokenBucket   = "token_bucket"
+	RateLimitSlidingWindow = "sliding_window"
+
+	_RATE_LIMIT_PREFIX = "ratelimit:"
+	// expired keys of MemRateLimitStore are removed at most once a minute
+	_RATE_LIMIT_SWEEP_INTERVAL = time.Minute
+)
+
+type RateLimitOptions struct {
+	// Limit requests are allowed in every Window
+	Limit  int
+	Window time.Duration
+	// Algorithm is RateLimitTokenBucket or RateLimitSlidingWindow, default RateLimitTokenBucket.
+	// The token bucket allows bursts of Limit requests, and refills Limit tokens in a Window evenly.
+	// The sliding window counts the requests of the last Window, weighted from the previous window.
+	Algorithm string
+	// Key returns the key limited, such as RateLimitByIP or RateLimitBySession,
+	// an empty key is not limited. Default RateLimitByIP.
+	Key func(c *Context) string
+	// Store keeps the states of keys, default a NewMemRateLimitStore of this middleware.
+	// Use NewRedisRateLimitStore to share limits across replicas.
+	Store RateLimitStore
+	// Prefix is added to the keys in store, default "ratelimit:"
+	Prefix string
+	// SkipPaths are not limited, such as "/health", a trailing "*" matches the prefix
+	SkipPaths []string
+}
+
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining requests allowed now
+	Remaining int
+	// Reset is how long until the limit is fully restored
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, 0 if this one is allowed
+	RetryAfter time.Duration
+}
+
+// RateLimitStore takes a request of key atomically
+type RateLimitStore interface {
+	Take(key string, algorithm string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// RateLimit responds 429 to the requests over the limit.
+// X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset (seconds) are added to responses,
+// and Retry-After (seconds) to the 429 ones.
+// Requests are allowed if the store fails, the error is logged.
+//
+//	server.Use(web.RateLimit(web.RateLimitOptions{
+//		Limit:  100,
+//		Window: time.Minute,
+//		Store:  web.NewRedisRateLimitStore(redis.UseRedis("default")),
+//	}))
+func RateLimit(opts RateLimitOptions) HandlerFunc {
+	if opts.Limit < 1 {
+		panic("rate limit should be positive")
+	}
+	if opts.Window < time.Millisecond {
+		panic("rate limit window should be at least 1ms")
+	}
+	if opts.Algorithm == "" {
+		opts.Algorithm = RateLimitTokenBucket
+	}
+	if opts.Algorithm != RateLimitTokenBucket && opts.Algorithm != RateLimitSlidingWindow {
+		panic("rate limit algorithm invalid " + opts.Algorithm)
+	}
+	if opts.Key == nil {
+		opts.Key = RateLimitByIP
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemRateLimitStore()
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = _RATE_LIMIT_PREFIX
+	}
+	limit := strconv.Itoa(opts.Limit)
+
+	return func(c *Context) {
+		if skipPath(c.Request.URL.Path, opts.SkipPaths) {
+			c.Next()
+			return
+		}
+		key := opts.Key(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+		result, err := opts.Store.Take(opts.Prefix+key, opts.Algorithm, opts.Limit, opts.Window)
+		if err != nil {
+			log.Error("rate limit faild", key, err.Error())
+			c.Next()
+			return
+		}
+		header := c.ResponseWriter.Header()
+		header.Set("X-RateLimit-Limit", limit)
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("X-RateLimit-Reset", ceilSeconds(result.Reset))
+		if !result.Allowed {
+			header.Set("Retry-After", ceilSeconds(result.RetryAfter))
+			c.AbortWithStatus(429)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimitByIP limits by c.ClientIP(), see SetTrustedProxies
+func RateLimitByIP(c *Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitBySession limits by the session started, or by the client ip if there is no session.
+// It should be used after the handler which starts the session.
+func RateLimitBySession(c *Context) string {
+	if session, ok := c.metaInternal.Load(_SESSION_META_KEY); ok {
+		return "session:" + session.(*Session).token
+	}
+	return RateLimitByIP(c)
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+type rateLimitState struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+	// sliding window, counts of the current and previous windows
+	window   int64
+	current  int
+	previous int
+
+	expired time.Time
+}
+
+// MemRateLimitStore keeps states in process, the limits are not shared by replicas
+type MemRateLimitStore struct {
+	mu     sync.Mutex
+	states map[string]*rateLimitState
+	swept  time.Time
+	now    func() time.Time
+}
+
+func NewMemRateLimitStore() *MemRateLimitStore {
+	return &MemRateLimitStore{
+		states: make(map[string]*rateLimitState),
+		now:    time.Now,
+	}
+}
+
+func (this *MemRateLimitStore) Take(key string, algorithm string, limit int, window time.Duration) (RateLimitResult, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	now := this.now()
+	if now.Sub(this.swept) >= _RATE_LIMIT_SWEEP_INTERVAL {
+		this.sweep(now)
+	}
+	state, ok := this.states[key]
+	if !ok {
+		state = &rateLimitState{}
+		this.states[key] = state
+	}
+	var result RateLimitResult
+	switch algorithm {
+	case RateLimitTokenBucket:
+		result = state.tokenBucket(limit, window, now)
+	case RateLimitSlidingWindow:
+		result = state.slidingWindow(limit, window, now)
+	default:
+		return result, errors.New("rate limit algorithm invalid " + algorithm)
+	}
+	state.expired = now.Add(result.Reset)
+	return result, nil
+}
+
+func (this *MemRateLimitStore) sweep(now time.Time) {
+	this.swept = now
+	for key, state := range this.states {
+		if !now.Before(state.expired) {
+			delete(this.states, key)
+		}
+	}
+}
+
+func (this *rateLimitState) tokenBucket(limit int, window time.Duration, now time.Time) RateLimitResult {
+	// tokens refilled per nanosecond
+	rate := float64(limit) / float64(window)
+	if this.last.IsZero() {
+		this.tokens = float64(limit)
+	} else if now.After(this.last) {
+		this.tokens = math.Min(float64(limit), this.tokens+float64(now.Sub(this.last))*rate)
+	}
+	if now.After(this.last) {
+		this.last = now
+	}
+	result := RateLimitResult{}
+	if this.tokens >= 1 {
+		this.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - this.tokens) / rate))
+	}
+	result.Remaining = int(this.tokens)
+	result.Reset = time.Duration(math.Ceil((float64(limit) - this.tokens) / rate))
+	return result
+}
+
+func (this *rateLimitState) slidingWindow(limit int, window time.Duration, now time.Time) RateLimitResult {
+	w := int64(window)
+	index := now.UnixNano() / w
+	if index == this.window+1 {
+		this.previous, this.current = this.current, 0
+	} else if index != this.window {
+		this.previous, this.current = 0, 0
+	}
+	this.window = index
+	elapsed := now.UnixNano() - index*w
+	count := float64(this.previous)*float64(w-elapsed)/float64(w) + float64(this.current)
+
+	result := RateLimitResult{}
+	if count+1 <= float64(limit) {
+		this.current++
+		count++
+		result.Allowed = true
+	} else if this.current+1 > limit {
+		// wait for the next window, until the weight of this one is low enough
+		result.RetryAfter = time.Duration(w - elapsed + int64(math.Ceil(float64(w)*(1-float64(limit-1)/float64(this.current)))))
+	} else {
+		// wait until the weight of the previous window is low enough
+		result.RetryAfter = time.Duration(math.Max(math.Ceil(float64(w-elapsed)-float64(limit-1-this.current)*float64(w)/float64(this.previous)), 1))
+	}
+	result.Remaining = int(math.Max(math.Floor(float64(limit)-count), 0))
+	if this.current > 0 {
+		result.Reset = time.Duration(2*w - elapsed)
+	} else if this.previous > 0 {
+		result.Reset = time.Duration(w - elapsed)
+	}
+	return result
+}
+
+// RateLimitRedis runs lua scripts, such as redis.UseRedis(name) of the redis package
+type RateLimitRedis interface {
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// RedisRateLimitStore keeps states in redis, so the limits are shared by replicas.
+// The scripts take the time of redis, they are atomic and not affected by the clocks of replicas.
+type RedisRateLimitStore struct {
+	redis RateLimitRedis
+}
+
+func NewRedisRateLimitStore(redis RateLimitRedis) *RedisRateLimitStore {
+	return &RedisRateLimitStore{redis: redis}
+}
+
+// returns {allowed, remaining, retry after, reset}, durations in milliseconds
+const _RATE_LIMIT_NOW_LUA = `
+if redis.replicate_commands then redis.replicate_commands() end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local limit, window = tonumber(ARGV[1]), tonumber(ARGV[2])
+`
+
+const _RATE_LIMIT_TOKEN_BUCKET_LUA = _RATE_LIMIT_NOW_LUA + `
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens, last = tonumber(state[1]), tonumber(state[2])
+if tokens == nil then
+	tokens, last = limit, now
+elseif now > last then
+	tokens = math.min(limit, tokens + (now - last) * limit / window)
+	last = now
+end
+local allowed, retry = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * window / limit)
+end
+local reset = math.ceil((limit - tokens) * window / limit)
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'last', last)
+redis.call('PEXPIRE', KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), retry, reset}
+`
+
+const _RATE_LIMIT_SLIDING_WINDOW_LUA = _RATE_LIMIT_NOW_LUA + `
+local index = math.floor(now / window)
+local state = redis.call('HMGET', KEYS[1], 'window', 'current', 'previous')
+local last, current, previous = tonumber(state[1]), tonumber(state[2]) or 0, tonumber(state[3]) or 0
+if last == index - 1 then
+	previous, current = current, 0
+elseif last ~= index then
+	previous, current = 0, 0
+end
+local elapsed = now - index * window
+local count = previous * (window - elapsed) / window + current
+local allowed, retry = 0, 0
+if count + 1 <= limit then
+	current = current + 1
+	count = count + 1
+	allowed = 1
+elseif current + 1 > limit then
+	retry = window - elapsed + math.ceil(window * (1 - (limit - 1) / current))
+else
+	retry = math.max(math.ceil(window - elapsed - (limit - 1 - current) * window / previous), 1)
+end
+local reset = 0
+if current > 0 then
+	reset = 2 * window - elapsed
+elseif previous > 0 then
+	reset = window - elapsed
+end
+redis.call('HMSET', KEYS[1], 'window', index, 'current', current, 'previous', previous)
+redis.call('PEXPIRE', KEYS[1], math.max(reset, 1))
+return {allowed, math.max(math.floor(limit - count), 0), retry, reset}
+`
+
+func (this *RedisRateLimitStore) Take(key string, algorithm string, limit int, window time.Duration) (RateLimitResult, error) {
+	var script string
+	switch algorithm {
+	case RateLimitTokenBucket:
+		script = _RATE_LIMIT_TOKEN_BUCKET_LUA
+	case RateLimitSlidingWindow:
+		script = _RATE_LIMIT_SLIDING_WINDOW_LUA
+	default:
+		return RateLimitResult{}, errors.New("rate limit algorithm invalid " + algorithm)
+	}
+	reply, err := this.redis.Eval(script, []string{key}, limit, int64(window/time.Millisecond))
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4 {
+		return RateLimitResult{}, fmt.Errorf("rate limit script reply invalid %v", reply)
+	}
+	numbers := make([]int64, len(values))
+	for i, value := range values {
+		if numbers[i], ok = value.(int64); !ok {
+			return RateLimitResult{}, fmt.Errorf("rate limit script reply invalid %v", reply)
+		}
+	}
+	return RateLimitResult{
+		Allowed:    numbers[0] == 1,
+		Remaining:  int(numbers[1]),
+		RetryAfter: time.Duration(numbers[2]) * time.Millisecond,
+		Reset:      time.Duration(numbers[3]) * time.Millisecond,
+	}, nil
+}
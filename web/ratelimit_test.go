@@ -0,0 +1,195 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	s := New("")
+	s.Use(RateLimit(RateLimitOptions{
+		Limit:     2,
+		Window:    10 * time.Second,
+		Store:     store,
+		SkipPaths: []string{"/health"},
+	}))
+	s.GET("/", func(c *Context) {
+		c.Text("ok")
+	})
+	s.GET("/health", func(c *Context) {
+		c.Text("ok")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	cases := []struct {
+		path       string
+		advance    time.Duration
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{"/", 0, 200, "1", "5", ""},
+		{"/", 0, 200, "0", "10", ""},
+		{"/", 0, 429, "0", "10", "5"},
+		{"/health", 0, 200, "", "", ""},
+		{"/", 2 * time.Second, 429, "0", "8", "3"},
+		{"/", 3 * time.Second, 200, "0", "10", ""},
+		{"/", 20 * time.Second, 200, "1", "5", ""},
+	}
+	for i, tc := range cases {
+		now = now.Add(tc.advance)
+		res, err := http.Get(ts.URL + tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.status || res.Header.Get("X-RateLimit-Remaining") != tc.remaining ||
+			res.Header.Get("X-RateLimit-Reset") != tc.reset || res.Header.Get("Retry-After") != tc.retryAfter {
+			t.Error(i, res.StatusCode, res.Header)
+		}
+		if tc.remaining != "" && res.Header.Get("X-RateLimit-Limit") != "2" {
+			t.Error(i, res.Header)
+		}
+	}
+
+	// expired keys are swept
+	now = now.Add(time.Hour)
+	store.Take("other", RateLimitTokenBucket, 2, time.Second)
+	if len(store.states) != 1 {
+		t.Error(store.states)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	store := NewMemRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	cases := []struct {
+		advance    time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{0, true, 3, 0},
+		{0, true, 2, 0},
+		{0, true, 1, 0},
+		{0, true, 0, 0},
+		// the next window at the middle, 4 requests count 2
+		{15 * time.Second, true, 1, 0},
+		{0, true, 0, 0},
+		{0, false, 0, time.Second * 5 / 2},
+		// 4 of the previous window count 0.8 near the end of this window
+		{3 * time.Second, true, 0, 0},
+		{0, false, 0, 2 * time.Second},
+	}
+	for i, tc := range cases {
+		now = now.Add(tc.advance)
+		result, err := store.Take("k", RateLimitSlidingWindow, 4, 10*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != tc.allowed || result.Remaining != tc.remaining ||
+			tc.retryAfter != 0 && result.RetryAfter != tc.retryAfter || !result.Allowed && result.RetryAfter <= 0 {
+			t.Error(i, result)
+		}
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	s := New("")
+	s.UseMemSession(time.Minute, time.Minute)
+	s.Use(func(c *Context) {
+		if token := c.Request.Header.Get("X-Token"); token != "" {
+			c.StartSession(token)
+		}
+		c.Next()
+	})
+	s.Use(RateLimit(RateLimitOptions{Limit: 1, Window: time.Minute, Key: RateLimitBySession}))
+	s.GET("/", func(c *Context) {
+		c.Text("ok")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	cases := []struct {
+		token  string
+		status int
+	}{
+		{"a", 200},
+		{"a", 429},
+		{"b", 200},
+		// by ip
+		{"", 200},
+		{"", 429},
+	}
+	for i, tc := range cases {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		if tc.token != "" {
+			req.Header.Set("X-Token", tc.token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tc.status {
+			t.Error(i, res.StatusCode)
+		}
+	}
+}
+
+type evalRedis struct {
+	reply interface{}
+	err   error
+	keys  []string
+	args  []interface{}
+}
+
+func (this *evalRedis) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	this.keys, this.args = keys, args
+	return this.reply, this.err
+}
+
+func TestRedisRateLimitStore(t *testing.T) {
+	redis := &evalRedis{reply: []interface{}{int64(0), int64(0), int64(1500), int64(60000)}}
+	store := NewRedisRateLimitStore(redis)
+	result, err := store.Take("ratelimit:ip:1.2.3.4", RateLimitSlidingWindow, 10, time.Minute)
+	if err != nil || result.Allowed || result.RetryAfter != 1500*time.Millisecond || result.Reset != time.Minute {
+		t.Error(result, err)
+	}
+	if redis.keys[0] != "ratelimit:ip:1.2.3.4" || redis.args[0] != 10 || redis.args[1] != int64(60000) {
+		t.Error(redis.keys, redis.args)
+	}
+
+	redis.reply = "OK"
+	if _, err := store.Take("k", RateLimitTokenBucket, 10, time.Minute); err == nil {
+		t.Error("invalid reply is accepted")
+	}
+
+	// requests are allowed if redis fails
+	redis.err = errors.New("connection refused")
+	s := New("")
+	s.Use(RateLimit(RateLimitOptions{Limit: 1, Window: time.Minute, Store: store}))
+	s.GET("/", func(c *Context) {
+		c.Text("ok")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 || res.Header.Get("X-RateLimit-Limit") != "" {
+		t.Error(res.StatusCode, res.Header)
+	}
+}
@@ -0,0 +1,196 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+)
+
+var jsonpCallbackReg = regexp.MustCompile(`^[a-zA-Z_$][0-9a-zA-Z_$.]*$`)
+
+// Status sets the http status used by the following renderer,
+// such as Json, Text, XML, HTML, JSONP and Data.
+func (this *Context) Status(status int) {
+	this.HttpStatus = status
+}
+
+func (this *Context) statusOr(status int) int {
+	if this.HttpStatus != 0 {
+		return this.HttpStatus
+	}
+	return status
+}
+
+func (this *Context) render(status int, contentType string, body []byte) error {
+	this.HttpStatus = status
+	this.ResponseWriter.Header().Set("Content-Type", contentType)
+	this.ResponseWriter.WriteHeader(status)
+	_, err := this.ResponseWriter.Write(body)
+	return err
+}
+
+// renderFailed responds 500 because nothing is written yet
+func (this *Context) renderFailed(kind string, err error) error {
+	log.Error("render "+kind+" failed", err)
+	this.DieWithHttpStatus(500)
+	return err
+}
+
+func (this *Context) XML(data interface{}) error {
+	out, err := xml.Marshal(data)
+	if err != nil {
+		return this.renderFailed("xml", err)
+	}
+	body := append([]byte(xml.Header), out...)
+	return this.render(this.statusOr(200), "application/xml; charset=utf-8", body)
+}
+
+// JSONP wraps the json with the callback in query "callback",
+// it responds json if there is no callback, and 400 if the callback is invalid.
+func (this *Context) JSONP(data interface{}) error {
+	callback := this.QueryDefault("callback", "")
+	if callback == "" {
+		return this.RenderJson(data)
+	}
+	if !jsonpCallbackReg.MatchString(callback) {
+		err := fmt.Errorf("invalid callback %q", callback)
+		log.Debug("render jsonp rejected", err)
+		this.DieWithHttpStatus(400)
+		return err
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		return this.renderFailed("jsonp", err)
+	}
+	this.Response = out
+	body := []byte("/**/" + callback + "(" + string(out) + ");")
+	return this.render(this.statusOr(200), "application/javascript; charset=utf-8", body)
+}
+
+func (this *Context) Data(contentType string, data []byte) error {
+	return this.render(this.statusOr(200), contentType, data)
+}
+
+// HTML renders a page loaded by Server.LoadHTML
+func (this *Context) HTML(name string, data interface{}) error {
+	if this.server == nil || this.server.html == nil {
+		return this.renderFailed("html", errors.New("html templates are not loaded"))
+	}
+	tmpl, ok := this.server.html[name]
+	if !ok {
+		return this.renderFailed("html", fmt.Errorf("html template %s not found", name))
+	}
+	// execute into a buffer, so a failed template responds 500 but not a half page
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return this.renderFailed("html", err)
+	}
+	return this.render(this.statusOr(200), "text/html; charset=utf-8", buf.Bytes())
+}
+
+// File responds the file with Content-Type, Last-Modified and ETag,
+// and handles Range, If-Modified-Since and If-None-Match requests.
+func (this *Context) File(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			this.DieWithHttpStatus(404)
+			return err
+		}
+		return this.renderFailed("file", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return this.renderFailed("file", err)
+	}
+	if info.IsDir() {
+		this.DieWithHttpStatus(404)
+		return fmt.Errorf("%s is a directory", filename)
+	}
+	this.ResponseWriter.Header().Set("Etag", fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	this.HttpStatus = 200
+	http.ServeContent(this.ResponseWriter, this.Request, info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// Attachment is like File but the browser saves it as filename
+func (this *Context) Attachment(filename string, name string) error {
+	if name == "" {
+		name = filepath.Base(filename)
+	}
+	this.ResponseWriter.Header().Set("Content-Disposition", fmt.Sprintf(
+		`attachment; filename="%s"; filename*=UTF-8''%s`, asciiFilename(name), url.PathEscape(name)))
+	return this.File(filename)
+}
+
+func asciiFilename(name string) string {
+	out := []byte{}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 0x20 || c > 0x7e || c == '"' || c == '\\' {
+			c = '_'
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
+
+// SetHTMLFuncs sets the funcs of templates, it should be called before LoadHTML
+func (this *Server) SetHTMLFuncs(funcs template.FuncMap) {
+	this.htmlFuncs = funcs
+}
+
+// LoadHTML loads pages matching pattern from fsys, which can be os.DirFS or embed.FS.
+// Files matching layouts, such as layouts and partials, are parsed with every page,
+// so a page can use a layout like:
+//
+//	{{template "layout.html" .}}
+//	{{define "content"}}...{{end}}
+//
+// A page is rendered by its path in fsys, like c.HTML("user/show.html", data).
+func (this *Server) LoadHTML(fsys fs.FS, pattern string, layouts ...string) error {
+	isLayout := map[string]bool{}
+	for _, layout := range layouts {
+		matches, err := fs.Glob(fsys, layout)
+		if err != nil {
+			return err
+		}
+		for _, match := range matches {
+			isLayout[match] = true
+		}
+	}
+	pages, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	html := map[string]*template.Template{}
+	for _, page := range pages {
+		if isLayout[page] {
+			continue
+		}
+		tmpl := template.New(path.Base(page)).Funcs(this.htmlFuncs)
+		if len(isLayout) > 0 {
+			if tmpl, err = tmpl.ParseFS(fsys, layouts...); err != nil {
+				return err
+			}
+		}
+		if tmpl, err = tmpl.ParseFS(fsys, page); err != nil {
+			return err
+		}
+		html[page] = tmpl
+		log.Debug("load html", page)
+	}
+	this.html = html
+	return nil
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"encoding/xml"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderers(t *testing.T) {
+	cases := []struct {
+		render      func(c *Context) error
+		status      int
+		contentType string
+		body        string
+		err         bool
+	}{
+		{func(c *Context) error { return c.RenderJson(map[string]int{"a": 1}) },
+			200, "application/json; charset=utf-8", `{"a":1}`, false},
+		{func(c *Context) error { return c.RenderJson(make(chan int)) },
+			500, "text/plain;charset=UTF-8", ``, true},
+		{func(c *Context) error {
+			c.Status(201)
+			return c.RenderText("created")
+		}, 201, "text/plain; charset=utf-8", `created`, false},
+		{func(c *Context) error {
+			return c.XML(struct {
+				XMLName xml.Name `xml:"user"`
+				Name    string   `xml:"name"`
+			}{Name: "cookie"})
+		}, 200, "application/xml; charset=utf-8", xml.Header + `<user><name>cookie</name></user>`, false},
+		{func(c *Context) error { return c.Data("image/png", []byte("png")) },
+			200, "image/png", `png`, false},
+	}
+	for i, c := range cases {
+		w := httptest.NewRecorder()
+		ctx := newContext(w, httptest.NewRequest("GET", "/", nil))
+		err := c.render(ctx)
+		if (err != nil) != c.err {
+			t.Error(i, err)
+		}
+		if w.Code != c.status || w.Header().Get("Content-Type") != c.contentType || w.Body.String() != c.body {
+			t.Error(i, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+func TestJSONP(t *testing.T) {
+	cases := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"?callback=cb.fn", 200, `/**/cb.fn({"a":1});`},
+		{"", 200, `{"a":1}`},
+		{"?callback=alert(1)//", 400, ``},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		c := newContext(w, httptest.NewRequest("GET", "/"+tc.query, nil))
+		err := c.JSONP(map[string]int{"a": 1})
+		if w.Code != tc.status || w.Body.String() != tc.body || (err != nil) != (tc.status != 200) {
+			t.Error(tc.query, w.Code, w.Body.String(), err)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layout/base.html":   {Data: []byte(`<html>{{block "content" .}}{{end}}{{template "footer.html"}}</html>`)},
+		"layout/footer.html": {Data: []byte(`<footer>{{upper "end"}}</footer>`)},
+		"user/show.html":     {Data: []byte(`{{template "base.html" .}}{{define "content"}}<p>{{.}}</p>{{end}}`)},
+		"post/show.html":     {Data: []byte(`{{template "base.html" .}}{{define "content"}}<h1>{{.}}</h1>{{end}}`)},
+		"broken.html":        {Data: []byte(`{{.Undefined.Field}}`)},
+	}
+	s := New("")
+	s.SetHTMLFuncs(template.FuncMap{"upper": strings.ToUpper})
+	if err := s.LoadHTML(fsys, "*/*.html", "layout/*.html"); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"user/show.html":   `<html><p>&lt;cookie&gt;</p><footer>END</footer></html>`,
+		"post/show.html":   `<html><h1>&lt;cookie&gt;</h1><footer>END</footer></html>`,
+		"layout/base.html": ``,
+	}
+	for name, expect := range cases {
+		w := httptest.NewRecorder()
+		c := newContext(w, httptest.NewRequest("GET", "/", nil))
+		c.server = s
+		err := c.HTML(name, "<cookie>")
+		if w.Body.String() != expect || (expect == "") != (err != nil) {
+			t.Error(name, w.Body.String(), err)
+		}
+		if expect != "" && w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Error(name, w.Header())
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kelp-web-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "data.txt")
+	ioutil.WriteFile(filename, []byte("0123456789"), 0644)
+
+	s := New("")
+	s.GET("/file", func(c *Context) {
+		c.File(filename)
+	})
+	s.GET("/attachment", func(c *Context) {
+		c.Attachment(filename, "报告.txt")
+	})
+	s.GET("/missing", func(c *Context) {
+		c.File(filepath.Join(dir, "missing"))
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	get := func(path string, header map[string]string) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", ts.URL+path, nil)
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		return res, string(body)
+	}
+	res, body := get("/file", nil)
+	etag := res.Header.Get("Etag")
+	if res.StatusCode != 200 || body != "0123456789" || etag == "" ||
+		res.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Error(res.StatusCode, body, res.Header)
+	}
+	if res, body := get("/file", map[string]string{"Range": "bytes=2-4"}); res.StatusCode != 206 || body != "234" {
+		t.Error(res.StatusCode, body)
+	}
+	if res, _ := get("/file", map[string]string{"If-None-Match": etag}); res.StatusCode != 304 {
+		t.Error(res.StatusCode)
+	}
+	res, _ = get("/attachment", nil)
+	if disposition := res.Header.Get("Content-Disposition"); disposition != `attachment; filename="______.txt"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.txt` {
+		t.Error(disposition)
+	}
+	if res, _ := get("/missing", nil); res.StatusCode != 404 {
+		t.Error(res.StatusCode)
+	}
+}
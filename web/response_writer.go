@@ -0,0 +1,245 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// responseWriter records the status, size and time to first byte of a response,
+// every write to Context.ResponseWriter goes through it.
+type responseWriter struct {
+	http.ResponseWriter
+
+	// httpStatus points to Context.HttpStatus, so it is right however the response is written
+	httpStatus *int
+	status     int
+	size       int64
+	start      time.Time
+	firstByte  time.Duration
+	hijacked   bool
+
+	// at most captureLimit bytes of the body are kept in captured, see AccessLog
+	captureLimit int
+	captured     []byte
+}
+
+func newResponseWriter(w http.ResponseWriter, httpStatus *int) *responseWriter {
+	return &responseWriter{
+		ResponseWriter: w,
+		httpStatus:     httpStatus,
+		start:          time.Now(),
+	}
+}
+
+func (this *responseWriter) WriteHeader(status int) {
+	if this.status != 0 || this.hijacked {
+		// let net/http log the superfluous call
+		this.ResponseWriter.WriteHeader(status)
+		return
+	}
+	// informational headers, such as 103 Early Hints, are followed by the real one
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		this.ResponseWriter.WriteHeader(status)
+		return
+	}
+	this.status = status
+	this.firstByte = time.Since(this.start)
+	*this.httpStatus = status
+	this.ResponseWriter.WriteHeader(status)
+}
+
+func (this *responseWriter) Write(b []byte) (int, error) {
+	if this.status == 0 && !this.hijacked {
+		this.WriteHeader(http.StatusOK)
+	}
+	n, err := this.ResponseWriter.Write(b)
+	this.size += int64(n)
+	if rest := this.captureLimit - len(this.captured); rest > 0 {
+		if rest > n {
+			rest = n
+		}
+		this.captured = append(this.captured, b[:rest]...)
+	}
+	return n, err
+}
+
+func (this *responseWriter) Flush() {
+	this.FlushError()
+}
+
+// FlushError is used by http.ResponseController,
+// it returns http.ErrNotSupported if the wrapped writer can not flush.
+func (this *responseWriter) FlushError() error {
+	if this.status == 0 {
+		this.WriteHeader(http.StatusOK)
+	}
+	return flushWriter(this.ResponseWriter)
+}
+
+func (this *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := this.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		this.hijacked = true
+		this.firstByte = time.Since(this.start)
+	}
+	return conn, rw, err
+}
+
+func (this *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := this.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Unwrap is used by http.ResponseController
+func (this *responseWriter) Unwrap() http.ResponseWriter {
+	return this.ResponseWriter
+}
+
+func flushWriter(w http.ResponseWriter) error {
+	switch f := w.(type) {
+	case interface{ FlushError() error }:
+		return f.FlushError()
+	case http.Flusher:
+		f.Flush()
+		return nil
+	}
+	return http.ErrNotSupported
+}
+
+// flushable reports whether the writer below the wrappers of this package can flush
+func flushable(w http.ResponseWriter) bool {
+	for {
+		switch inner := w.(type) {
+		case *responseWriter:
+			w = inner.ResponseWriter
+		case *compressWriter:
+			w = inner.ResponseWriter
+		default:
+			_, ok := w.(http.Flusher)
+			if !ok {
+				_, ok = w.(interface{ FlushError() error })
+			}
+			return ok
+		}
+	}
+}
+
+// Written reports whether the response header is written or the connection is hijacked
+func (this *Context) Written() bool {
+	return this.writer != nil && (this.writer.status != 0 || this.writer.hijacked)
+}
+
+// ResponseSize is the number of body bytes written
+func (this *Context) ResponseSize() int64 {
+	if this.writer == nil {
+		return 0
+	}
+	return this.writer.size
+}
+
+// TimeToFirstByte is the duration from the request arriving to the response header written,
+// it is 0 if nothing is written yet.
+func (this *Context) TimeToFirstByte() time.Duration {
+	if this.writer == nil {
+		return 0
+	}
+	return this.writer.firstByte
+}
+
+// rawResponseWriter is the writer from net/http,
+// http.MaxBytesReader closes the connection after a too large body only with it.
+func (this *Context) rawResponseWriter() http.ResponseWriter {
+	w := this.ResponseWriter
+	for {
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return w
+		}
+		w = unwrapper.Unwrap()
+	}
+}
+
+// timeoutWriter buffers the response of handlers after Timeout,
+// it is written to the real writer only if they return before the deadline.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	buf      bytes.Buffer
+	timedOut bool
+}
+
+func newTimeoutWriter(header http.Header) *timeoutWriter {
+	return &timeoutWriter{header: header.Clone()}
+}
+
+func (this *timeoutWriter) Header() http.Header {
+	return this.header
+}
+
+func (this *timeoutWriter) WriteHeader(status int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.timedOut || this.status != 0 || status < 200 {
+		return
+	}
+	this.status = status
+}
+
+func (this *timeoutWriter) Write(b []byte) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+	return this.buf.Write(b)
+}
+
+// sendPanic sends p if it is not timed out, timeout and sendPanic are exclusive,
+// so a panic is either read after timeout or logged by the handler goroutine.
+func (this *timeoutWriter) sendPanic(panicChan chan interface{}, p interface{}) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.timedOut {
+		return false
+	}
+	panicChan <- p
+	return true
+}
+
+func (this *timeoutWriter) timeout() {
+	this.mu.Lock()
+	this.timedOut = true
+	this.mu.Unlock()
+}
+
+// writeTo copies the headers, and the status and body if written
+func (this *timeoutWriter) writeTo(w http.ResponseWriter) {
+	dst := w.Header()
+	for k := range dst {
+		if _, ok := this.header[k]; !ok {
+			delete(dst, k)
+		}
+	}
+	for k, v := range this.header {
+		dst[k] = v
+	}
+	if this.status == 0 {
+		return
+	}
+	w.WriteHeader(this.status)
+	w.Write(this.buf.Bytes())
+}
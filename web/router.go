@@ -1,7 +1,10 @@
 package web
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 )
 
@@ -22,33 +25,72 @@ func (this Params) Get(key string) (string, bool) {
 }
 
 type Router struct {
-	path         string
-	realPath     string
-	method       string
+	path     string
+	realPath string
+	method   string
+	parent   *Router
+	children []*Router
+
+	// handlerChain is parent's handlerChain + middleware + handlers,
+	// and is rebuilt for the whole subtree when Use is called
+	middleware   []HandlerFunc
+	handlers     []HandlerFunc
 	handlerChain []HandlerFunc
-	children     []*Router
+	// cors are the middleware added by Router.CORS, automatic preflights run only them
+	cors []HandlerFunc
+
+	maxBodyBytes int64
+
+	trees map[string]*node
+	names map[string]*Router
+	name  string
 }
 
 type HandlerFunc func(*Context)
 
+var anyMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
 func (this *Router) Group(path string) *Router {
 	router := &Router{
 		path:         path,
 		realPath:     this.realPath + path,
 		method:       "",
+		parent:       this,
 		handlerChain: append([]HandlerFunc{}, this.handlerChain...),
 		children:     []*Router{},
+		trees:        this.trees,
+		names:        this.names,
 	}
 	this.children = append(this.children, router)
 	return router
 }
 
+// Use adds handler to this router and every router below it,
+// no matter they are added before or after.
 func (this *Router) Use(handler HandlerFunc) *Router {
-	this.handlerChain = append(this.handlerChain, handler)
+	this.middleware = append(this.middleware, handler)
+	this.buildHandlerChain()
+	return this
+}
+
+func (this *Router) buildHandlerChain() {
+	handlerChain := []HandlerFunc{}
+	if this.parent != nil {
+		handlerChain = append(handlerChain, this.parent.handlerChain...)
+	}
+	handlerChain = append(handlerChain, this.middleware...)
+	this.handlerChain = append(handlerChain, this.handlers...)
 	for _, router := range this.children {
-		router.handlerChain = append(router.handlerChain, handler)
+		router.buildHandlerChain()
 	}
-	return this
 }
 
 func (this *Router) GET(path string, handlers ...HandlerFunc) *Router {
@@ -67,9 +109,40 @@ func (this *Router) DELETE(path string, handlers ...HandlerFunc) *Router {
 	return this.handle(http.MethodDelete, path, handlers...)
 }
 
+func (this *Router) PATCH(path string, handlers ...HandlerFunc) *Router {
+	return this.handle(http.MethodPatch, path, handlers...)
+}
+
+func (this *Router) HEAD(path string, handlers ...HandlerFunc) *Router {
+	return this.handle(http.MethodHead, path, handlers...)
+}
+
+func (this *Router) OPTIONS(path string, handlers ...HandlerFunc) *Router {
+	return this.handle(http.MethodOptions, path, handlers...)
+}
+
+// Any registers the handlers for every method in anyMethods
+func (this *Router) Any(path string, handlers ...HandlerFunc) []*Router {
+	routers := []*Router{}
+	for _, method := range anyMethods {
+		if router := this.handle(method, path, handlers...); router != nil {
+			routers = append(routers, router)
+		}
+	}
+	return routers
+}
+
+func (this *Router) Handle(method, path string, handlers ...HandlerFunc) *Router {
+	if method == "" || strings.ToUpper(method) != method {
+		log.Error("add router faild, invalid method", method, path)
+		return nil
+	}
+	return this.handle(method, path, handlers...)
+}
+
 func (this *Router) handle(method string, path string, handlers ...HandlerFunc) *Router {
 	if len(path) < 1 || path[0] != '/' || strings.Contains(path, "//") {
-		log.Debug("add router faild, invalid path", path)
+		log.Error("add router faild, invalid path", method, path)
 		return nil
 	}
 	if sepIndex := strings.Index(path[1:], "/") + 1; sepIndex > 1 {
@@ -92,14 +165,114 @@ func (this *Router) handle(method string, path string, handlers ...HandlerFunc)
 		path:         path,
 		realPath:     this.realPath + path,
 		method:       method,
+		parent:       this,
+		handlers:     append([]HandlerFunc{}, handlers...),
 		handlerChain: handlerChain,
 		children:     []*Router{},
+		trees:        this.trees,
+		names:        this.names,
+	}
+	if err := router.addToTree(); err != nil {
+		log.Error("add router faild,", err, router.method, router.realPath)
+		return nil
 	}
 	this.children = append(this.children, router)
 	log.Debug("add router", router.method, router.realPath)
 	return router
 }
 
+func (this *Router) addToTree() error {
+	path := this.realPath
+	if this.method == HTTP_PROXY_METHOD && !strings.Contains(path, "*") {
+		// a proxy router also catches every path below it
+		if err := this.insert(path); err != nil {
+			return err
+		}
+		path = strings.TrimSuffix(path, "/") + "/*" + _PROXY_PATH_PARAM
+	}
+	return this.insert(path)
+}
+
+func (this *Router) insert(path string) error {
+	root, ok := this.trees[this.method]
+	if !ok {
+		root = &node{}
+		this.trees[this.method] = root
+	}
+	return root.addRoute(path, this)
+}
+
+// Name names the router for building its url by Server.URL
+func (this *Router) Name(name string) *Router {
+	if this == nil {
+		// the registration failed and returned nil, its error is logged by handle
+		log.Error("router name", name, "is not set, the router is not added, see the error above")
+		return nil
+	}
+	if router, ok := this.names[name]; ok && router != this {
+		log.Warn("router name", name, "is replaced,", router.method, router.realPath)
+	}
+	this.name = name
+	this.names[name] = this
+	return this
+}
+
+// url builds the path of the router named name,
+// params are key value pairs like: "id", "42", "status", "ok"
+func (this *Router) url(name string, params ...string) (string, error) {
+	router, ok := this.names[name]
+	if !ok {
+		return "", fmt.Errorf("router %s not found", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("router %s params should be key value pairs", name)
+	}
+	values := map[string]string{}
+	for i := 0; i < len(params); i += 2 {
+		values[params[i]] = params[i+1]
+	}
+	segments := strings.Split(router.realPath, "/")
+	for i, segment := range segments {
+		if len(segment) < 1 || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+		key := segment[1:]
+		var match ParamTypeFunc
+		if segment[0] == ':' {
+			key, _, match, _ = parseParam(segment[1:])
+		}
+		value, ok := values[key]
+		if !ok {
+			return "", fmt.Errorf("router %s param %s missing", name, key)
+		}
+		if match != nil && !match(value) {
+			return "", fmt.Errorf("router %s param %s=%s mismatch %s", name, key, value, segment)
+		}
+		delete(values, key)
+		if segment[0] == '*' {
+			parts := strings.Split(value, "/")
+			for j, part := range parts {
+				parts[j] = url.PathEscape(part)
+			}
+			segments[i] = strings.Join(parts, "/")
+		} else {
+			if value == "" {
+				return "", fmt.Errorf("router %s param %s is empty", name, key)
+			}
+			segments[i] = url.PathEscape(value)
+		}
+	}
+	if len(values) > 0 {
+		keys := []string{}
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return "", fmt.Errorf("router %s has no param %s", name, strings.Join(keys, ","))
+	}
+	return strings.Join(segments, "/"), nil
+}
+
 func (this *Router) find(method, path string) (*Router, Params) {
 	// path should not like:
 	//	1. ""
@@ -113,7 +286,7 @@ func (this *Router) find(method, path string) (*Router, Params) {
 	//	4. "/xxx/xxx"
 	//	5. "/xxx/xxx/"
 	//	6. ...
-	params := []Param{}
+	params := Params{}
 	if len(path) < 1 || path[0] != '/' || strings.HasPrefix(path, "//") {
 		log.Debug("invalid path", path)
 		return nil, params
@@ -123,42 +296,52 @@ func (this *Router) find(method, path string) (*Router, Params) {
 		log.Debug("illegal path charactor", path)
 		return nil, params
 	}
-	sepIndex := strings.Index(path[1:], "/") + 1
-	if sepIndex < 1 {
-		// find in this level
-		for _, router := range this.children {
-			if router.method == HTTP_PROXY_METHOD || router.method == method {
-				if isParamPath(router.path) {
-					params = append(params, Param{router.path[2:], path[1:]})
-				}
-				if isParamPath(router.path) || router.path == path {
-					return router, params
-				}
-			}
-		}
-		log.Debug("router not found", this.realPath, method, path)
-	} else {
-		root := path[:sepIndex]
-		subpath := path[sepIndex:]
-		// find in next level
-		for _, router := range this.children {
-			if router.method == "" {
-				if isParamPath(router.path) {
-					params = append(params, Param{router.path[2:], root[1:]})
-				}
-				if isParamPath(router.path) || router.path == root {
-					subrouter, subparams := router.find(method, subpath)
-					return subrouter, append(params, subparams...)
-				}
-			} else if router.method == HTTP_PROXY_METHOD {
+	for _, m := range []string{method, HTTP_PROXY_METHOD} {
+		if root, ok := this.trees[m]; ok {
+			if router := root.lookup(path, &params); router != nil {
 				return router, params
 			}
 		}
-		log.Debug("group not found", this.realPath, method, root, subpath)
 	}
+	log.Debug("router not found", method, path)
 	return nil, params
 }
 
-func isParamPath(path string) bool {
-	return len(path) > 2 && path[1] == ':'
+// allowed returns the methods which have a router matching the path,
+// HEAD is allowed with GET, and OPTIONS is allowed with any method.
+func (this *Router) allowed(path string) []string {
+	methods := []string{}
+	for method, root := range this.trees {
+		if method == HTTP_PROXY_METHOD {
+			continue
+		}
+		params := Params{}
+		if root.lookup(path, &params) != nil {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) < 1 {
+		return methods
+	}
+	has := func(method string) bool {
+		for _, m := range methods {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	}
+	if has(http.MethodGet) && !has(http.MethodHead) {
+		methods = append(methods, http.MethodHead)
+	}
+	if !has(http.MethodOptions) {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// middlewareChain is the handler chain without the handlers of the router itself
+func (this *Router) middlewareChain() []HandlerFunc {
+	return this.handlerChain[:len(this.handlerChain)-len(this.handlers)]
 }
@@ -1,3 +1,319 @@
 package web
 
-import ()
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func newTestRouter(paths ...string) *Router {
+	router := New("").router
+	for _, path := range paths {
+		if router.GET(path, func(c *Context) {}) == nil {
+			panic("add router failed " + path)
+		}
+	}
+	return router
+}
+
+func TestRouterFind(t *testing.T) {
+	router := newTestRouter(
+		"/",
+		"/user/new",
+		"/user/:id",
+		"/user/:id/profile",
+		"/user/new/:tab",
+		"/us",
+		"/static/*filepath",
+		"/static/css/main.css",
+	)
+	cases := []struct {
+		path   string
+		route  string
+		params map[string]string
+	}{
+		{"/", "/", nil},
+		{"/us", "/us", nil},
+		{"/user/new", "/user/new", nil},
+		{"/user/42", "/user/:id", map[string]string{"id": "42"}},
+		{"/user/new/profile", "/user/new/:tab", map[string]string{"tab": "profile"}},
+		{"/user/42/profile", "/user/:id/profile", map[string]string{"id": "42"}},
+		{"/user/ne/profile", "/user/:id/profile", map[string]string{"id": "ne"}},
+		{"/static/css/main.css", "/static/css/main.css", nil},
+		{"/static/css/other.css", "/static/*filepath", map[string]string{"filepath": "css/other.css"}},
+		{"/static/", "/static/*filepath", map[string]string{"filepath": ""}},
+		{"/user", "", nil},
+		{"/user/", "", nil},
+		{"/user/42/other", "", nil},
+		{"/static", "", nil},
+	}
+	for _, c := range cases {
+		route, params := router.find("GET", c.path)
+		if c.route == "" {
+			if route != nil {
+				t.Error(c.path, "should not found but", route.realPath)
+			}
+			continue
+		}
+		if route == nil {
+			t.Error(c.path, "not found")
+			continue
+		}
+		if route.realPath != c.route {
+			t.Error(c.path, "found", route.realPath, "expect", c.route)
+		}
+		if len(params) != len(c.params) {
+			t.Error(c.path, "params", params)
+		}
+		for key, value := range c.params {
+			if v, _ := params.Get(key); v != value {
+				t.Error(c.path, "param", key, v, "expect", value)
+			}
+		}
+	}
+	if route, _ := router.find("POST", "/user/new"); route != nil {
+		t.Error("method should not match")
+	}
+}
+
+func TestRouterConstraint(t *testing.T) {
+	router := newTestRouter(
+		"/user/:name",
+		"/user/:id<int>",
+		"/user/:id<int>/edit",
+		"/item/:uuid<uuid>",
+		"/post/:slug<[a-z-]+>",
+	)
+	cases := map[string]string{
+		"/user/42":       "/user/:id<int>",
+		"/user/-1":       "/user/:id<int>",
+		"/user/abc":      "/user/:name",
+		"/user/42/edit":  "/user/:id<int>/edit",
+		"/user/abc/edit": "",
+		"/item/4f5c0b5e-3b7a-4c1e-9a43-1d2f3c4b5a69": "/item/:uuid<uuid>",
+		"/item/42":          "",
+		"/post/hello-world": "/post/:slug<[a-z-]+>",
+		"/post/Hello":       "",
+	}
+	for path, expect := range cases {
+		route, _ := router.find("GET", path)
+		if expect == "" {
+			if route != nil {
+				t.Error(path, "should not found but", route.realPath)
+			}
+			continue
+		}
+		if route == nil || route.realPath != expect {
+			t.Error(path, "found", route, "expect", expect)
+		}
+	}
+	for _, path := range []string{"/a/:id<int", "/b/:id<>", "/c/:<int>", "/d/:id<[a-z>"} {
+		if router.GET(path, func(c *Context) {}) != nil {
+			t.Error("should not add", path)
+		}
+	}
+
+	s := New("")
+	s.GET("/user/:id<int>", func(c *Context) {}).Name("user")
+	if url, err := s.URL("user", "id", "42"); err != nil || url != "/user/42" {
+		t.Error(url, err)
+	}
+	if _, err := s.URL("user", "id", "abc"); err == nil {
+		t.Error("constraint should be checked")
+	}
+}
+
+func TestParamTyped(t *testing.T) {
+	c := &Context{Params: Params{{"id", "42"}, {"name", "abc"}}}
+	if id, err := c.ParamInt64("id"); err != nil || id != 42 {
+		t.Error(id, err)
+	}
+	if _, err := c.ParamInt("name"); err == nil {
+		t.Error("name is not int")
+	}
+	if _, err := c.ParamUint64("undefined"); err == nil {
+		t.Error("undefined param")
+	}
+}
+
+func TestRouterUse(t *testing.T) {
+	s := New("")
+	trace := []string{}
+	mark := func(name string) HandlerFunc {
+		return func(c *Context) {
+			trace = append(trace, name)
+			c.Next()
+		}
+	}
+	api := s.Group("/api")
+	s.Use(mark("root"))
+	api.GET("/v1/user/:id", mark("handler"))
+	api.Use(mark("api"))
+	s.Use(mark("root2"))
+	route, _ := s.router.find("GET", "/api/v1/user/1")
+	if route == nil {
+		t.Fatal("route not found")
+	}
+	c := &Context{handlerChain: route.handlerChain}
+	c.handlerChain[0](c)
+	if strings.Join(trace, ",") != "root,root2,api,handler" {
+		t.Error(trace)
+	}
+}
+
+func TestContextAbort(t *testing.T) {
+	trace := []string{}
+	aborted := false
+	c := &Context{handlerChain: []HandlerFunc{
+		func(c *Context) {
+			trace = append(trace, "outer")
+			c.Next()
+			aborted = c.IsAborted()
+		},
+		func(c *Context) {
+			trace = append(trace, "auth")
+			c.Abort()
+			c.Next()
+		},
+		func(c *Context) {
+			trace = append(trace, "handler")
+		},
+	}}
+	c.handlerChain[0](c)
+	if strings.Join(trace, ",") != "outer,auth" || !aborted {
+		t.Error(trace, aborted)
+	}
+}
+
+func TestRouterConflict(t *testing.T) {
+	router := newTestRouter("/a/:id", "/b/*filepath")
+	for _, path := range []string{
+		"/a/:id",
+		"/b/*other",
+		"/c/*filepath/d",
+		"/d/x:id",
+		"/e/:",
+	} {
+		if router.GET(path, func(c *Context) {}) != nil {
+			t.Error("should not add", path)
+		}
+	}
+}
+
+func TestRouterProxy(t *testing.T) {
+	router := newTestRouter("/a/b")
+	router.PROXY("/p", func(c *Context) {})
+	cases := map[string]string{
+		"/p":       "/p",
+		"/p/x/y":   "/p",
+		"/a/b":     "/a/b",
+		"/a/other": "",
+		"/other/p": "",
+	}
+	for path, expect := range cases {
+		route, params := router.find("GET", path)
+		if expect == "" {
+			if route != nil {
+				t.Error(path, "should not found but", route.realPath)
+			}
+			continue
+		}
+		if route == nil || route.realPath != expect {
+			t.Error(path, "found", route, "expect", expect)
+		}
+		if path == "/p/x/y" {
+			if v, _ := params.Get(_PROXY_PATH_PARAM); v != "x/y" {
+				t.Error("proxy path", v)
+			}
+		}
+	}
+}
+
+func TestRouterAllowed(t *testing.T) {
+	router := newTestRouter("/a", "/b/:id")
+	router.POST("/a", func(c *Context) {})
+	router.PATCH("/b/:id", func(c *Context) {})
+	router.OPTIONS("/c", func(c *Context) {})
+	if router.Handle("get", "/d", func(c *Context) {}) != nil {
+		t.Error("method should be upper case")
+	}
+	cases := map[string]string{
+		"/a":   "GET,HEAD,OPTIONS,POST",
+		"/b/1": "GET,HEAD,OPTIONS,PATCH",
+		"/c":   "OPTIONS",
+		"/d":   "",
+	}
+	for path, expect := range cases {
+		if allow := strings.Join(router.allowed(path), ","); allow != expect {
+			t.Error(path, "allow", allow, "expect", expect)
+		}
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	s := New("")
+	handler := func(c *Context) {}
+	s.GET("/user/:id", handler).Name("user.show")
+	s.Group("/static").GET("/*filepath", handler).Name("static")
+	s.GET("/about", handler).Name("about")
+	// the conflict is not added, and naming it does not panic
+	s.GET("/about", handler).Name("about.again")
+	cases := []struct {
+		name   string
+		params []string
+		url    string
+	}{
+		{"user.show", []string{"id", "42"}, "/user/42"},
+		{"user.show", []string{"id", "a b"}, "/user/a%20b"},
+		{"static", []string{"filepath", "css/main.css"}, "/static/css/main.css"},
+		{"about", nil, "/about"},
+		{"user.show", nil, ""},
+		{"user.show", []string{"id"}, ""},
+		{"user.show", []string{"id", ""}, ""},
+		{"user.show", []string{"id", "42", "other", "1"}, ""},
+		{"about", []string{"id", "42"}, ""},
+		{"undefined", nil, ""},
+		{"about.again", nil, ""},
+	}
+	for _, c := range cases {
+		url, err := s.URL(c.name, c.params...)
+		if c.url == "" {
+			if err == nil {
+				t.Error(c.name, c.params, "should error but", url)
+			}
+			continue
+		}
+		if err != nil || url != c.url {
+			t.Error(c.name, c.params, url, err)
+		}
+	}
+}
+
+type quietLogger struct{}
+
+func (lg *quietLogger) Debug(msg ...interface{}) {}
+func (lg *quietLogger) Info(msg ...interface{})  {}
+func (lg *quietLogger) Warn(msg ...interface{})  {}
+func (lg *quietLogger) Error(msg ...interface{}) {}
+
+func BenchmarkRouterFind(b *testing.B) {
+	defer SetLogger(log)
+	SetLogger(&quietLogger{})
+	for _, n := range []int{10, 100, 1000, 10000} {
+		paths := []string{}
+		for i := 0; i < n; i++ {
+			paths = append(paths,
+				fmt.Sprintf("/api/v%d/user/:id", i),
+				fmt.Sprintf("/api/v%d/item/%d/detail", i, i),
+			)
+		}
+		router := newTestRouter(paths...)
+		path := fmt.Sprintf("/api/v%d/user/42", n/2)
+		b.Run(fmt.Sprintf("routes=%d", len(paths)), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				router.find("GET", path)
+			}
+		})
+	}
+}
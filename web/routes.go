@@ -0,0 +1,50 @@
+package web
+
+import (
+	"reflect"
+	"runtime"
+)
+
+type RouteInfo struct {
+	Method   string   `json:"method"`
+	Path     string   `json:"path"`
+	Name     string   `json:"name"`
+	Handlers []string `json:"handlers"`
+}
+
+// Routes returns every router with handlers in registration order
+func (this *Server) Routes() []RouteInfo {
+	return this.router.routes([]RouteInfo{})
+}
+
+// ExposeRoutes serves the result of Routes as json on /_kelp/routes
+func (this *Server) ExposeRoutes() {
+	this.exposeRoutes = true
+}
+
+func (this *Router) routes(routes []RouteInfo) []RouteInfo {
+	for _, router := range this.children {
+		if router.method == "" {
+			routes = router.routes(routes)
+			continue
+		}
+		handlers := []string{}
+		for _, handler := range router.handlerChain {
+			handlers = append(handlers, handlerName(handler))
+		}
+		routes = append(routes, RouteInfo{
+			Method:   router.method,
+			Path:     router.realPath,
+			Name:     router.name,
+			Handlers: handlers,
+		})
+	}
+	return routes
+}
+
+func handlerName(handler HandlerFunc) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "unknown"
+}
@@ -0,0 +1,244 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CSPNonce is replaced by 'nonce-...' of each request, get it by c.CSPNonce()
+	CSPNonce = "'nonce'"
+
+	_CSP_NONCE_META_KEY = "csp_nonce"
+	_CSP_NONCE_BYTES    = 16
+	_REFERRER_POLICY    = "strict-origin-when-cross-origin"
+)
+
+// CSP builds a Content-Security-Policy, directives are written in the order they are added
+//
+//	web.NewCSP().
+//		Add("default-src", "'self'").
+//		Add("script-src", "'self'", web.CSPNonce).
+//		Add("upgrade-insecure-requests")
+type CSP struct {
+	directives []string
+	sources    map[string][]string
+	nonce      bool
+}
+
+func NewCSP() *CSP {
+	return &CSP{sources: make(map[string][]string)}
+}
+
+// Add adds sources to the directive, such as "'self'", "https://cdn.example.com" or CSPNonce
+func (this *CSP) Add(directive string, sources ...string) *CSP {
+	directive = strings.ToLower(strings.TrimSpace(directive))
+	if _, ok := this.sources[directive]; !ok {
+		this.directives = append(this.directives, directive)
+	}
+	this.sources[directive] = append(this.sources[directive], sources...)
+	for _, source := range sources {
+		if source == CSPNonce {
+			this.nonce = true
+		}
+	}
+	return this
+}
+
+func (this *CSP) Has(directive string) bool {
+	_, ok := this.sources[strings.ToLower(directive)]
+	return ok
+}
+
+// Build returns the policy, CSPNonce is replaced by nonce
+func (this *CSP) Build(nonce string) string {
+	policies := make([]string, 0, len(this.directives))
+	for _, directive := range this.directives {
+		policy := directive
+		for _, source := range this.sources[directive] {
+			if source == CSPNonce {
+				source = "'nonce-" + nonce + "'"
+			}
+			policy += " " + source
+		}
+		policies = append(policies, policy)
+	}
+	return strings.Join(policies, "; ")
+}
+
+func (this *CSP) clone() *CSP {
+	csp := NewCSP()
+	for _, directive := range this.directives {
+		csp.Add(directive, this.sources[directive]...)
+	}
+	return csp
+}
+
+func (this *CSP) String() string {
+	return this.Build("")
+}
+
+type SecureHeadersOptions struct {
+	// HSTSMaxAge sends Strict-Transport-Security in https responses, 0 means not sent
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// CSP is sent as Content-Security-Policy, nil means not sent
+	CSP *CSP
+	// CSPReportOnly sends it as Content-Security-Policy-Report-Only
+	CSPReportOnly bool
+
+	// FrameOptions is X-Frame-Options, "DENY" or "SAMEORIGIN", default "DENY", "-" means not sent.
+	// The same frame-ancestors is added to CSP if CSP does not have it.
+	FrameOptions string
+	// ReferrerPolicy default "strict-origin-when-cross-origin", "-" means not sent
+	ReferrerPolicy string
+	// PermissionsPolicy is sent if it is not empty, such as "camera=(), microphone=(), geolocation=()"
+	PermissionsPolicy string
+
+	// HTTPSRedirect redirects http requests to https with 308.
+	// The scheme from trusted proxies is honored, see Context.Scheme.
+	// HTTPSHost or RedirectHosts is required, the Host header is never trusted as is.
+	HTTPSRedirect bool
+	// HTTPSHost is the host redirected to, such as "example.com:8443"
+	HTTPSHost string
+	// RedirectHosts are the hosts of requests redirected to themselves without port, such as "example.com",
+	// other hosts are redirected to HTTPSHost, or responded 400 if HTTPSHost is empty.
+	RedirectHosts []string
+	// RedirectSkipPaths are not redirected, such as "/health" checked by http, a trailing "*" matches the prefix
+	RedirectSkipPaths []string
+}
+
+// SecureHeaders sets security headers to responses, X-Content-Type-Options: nosniff is always set.
+//
+//	server.Use(web.SecureHeaders(web.SecureHeadersOptions{
+//		HSTSMaxAge:    365 * 24 * time.Hour,
+//		CSP:           web.NewCSP().Add("default-src", "'self'").Add("script-src", "'self'", web.CSPNonce),
+//		HTTPSRedirect: true,
+//		HTTPSHost:     "example.com",
+//	}))
+func SecureHeaders(opts SecureHeadersOptions) HandlerFunc {
+	if opts.FrameOptions == "" {
+		opts.FrameOptions = "DENY"
+	}
+	opts.FrameOptions = strings.ToUpper(opts.FrameOptions)
+	if opts.FrameOptions != "DENY" && opts.FrameOptions != "SAMEORIGIN" && opts.FrameOptions != "-" {
+		panic("frame options invalid " + opts.FrameOptions)
+	}
+	if opts.ReferrerPolicy == "" {
+		opts.ReferrerPolicy = _REFERRER_POLICY
+	}
+	if opts.HTTPSRedirect && opts.HTTPSHost == "" && len(opts.RedirectHosts) == 0 {
+		panic("https redirect needs HTTPSHost or RedirectHosts")
+	}
+	redirectHosts := make(map[string]bool, len(opts.RedirectHosts))
+	for _, host := range opts.RedirectHosts {
+		redirectHosts[strings.ToLower(host)] = true
+	}
+
+	hsts := ""
+	if opts.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(opts.HSTSMaxAge/time.Second))
+		if opts.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if opts.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	cspHeader := "Content-Security-Policy"
+	if opts.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+	if opts.CSP != nil {
+		// frame-ancestors is added to a copy, the CSP given may be shared
+		opts.CSP = opts.CSP.clone()
+	}
+	if opts.CSP != nil && !opts.CSP.Has("frame-ancestors") {
+		switch opts.FrameOptions {
+		case "DENY":
+			opts.CSP.Add("frame-ancestors", "'none'")
+		case "SAMEORIGIN":
+			opts.CSP.Add("frame-ancestors", "'self'")
+		}
+	}
+	// the policy is built once if there is no nonce
+	policy := ""
+	if opts.CSP != nil && !opts.CSP.nonce {
+		policy = opts.CSP.String()
+	}
+
+	return func(c *Context) {
+		https := c.Scheme() == "https"
+		if opts.HTTPSRedirect && !https && !skipPath(c.Request.URL.Path, opts.RedirectSkipPaths) {
+			host := strings.ToLower(c.Request.Host)
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if !redirectHosts[host] {
+				host = opts.HTTPSHost
+			}
+			if host == "" {
+				log.Warn("https redirect of host not allowed", c.Request.Host, c.ClientIP())
+				c.AbortWithStatus(400)
+				return
+			}
+			c.Redirect(http.StatusPermanentRedirect, "https://"+host+c.Request.URL.RequestURI())
+			c.Abort()
+			return
+		}
+
+		header := c.ResponseWriter.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		if opts.FrameOptions != "-" {
+			header.Set("X-Frame-Options", opts.FrameOptions)
+		}
+		if opts.ReferrerPolicy != "-" {
+			header.Set("Referrer-Policy", opts.ReferrerPolicy)
+		}
+		if opts.PermissionsPolicy != "" {
+			header.Set("Permissions-Policy", opts.PermissionsPolicy)
+		}
+		if hsts != "" && https {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+		if opts.CSP != nil {
+			if opts.CSP.nonce {
+				nonce, err := newCSPNonce()
+				if err != nil {
+					c.Error(-1, err)
+					c.Abort()
+					return
+				}
+				c.metaInternal.Store(_CSP_NONCE_META_KEY, nonce)
+				header.Set(cspHeader, opts.CSP.Build(nonce))
+			} else {
+				header.Set(cspHeader, policy)
+			}
+		}
+		c.Next()
+	}
+}
+
+// CSPNonce returns the nonce of this request, if CSPNonce is used in the CSP of SecureHeaders.
+// Use it in templates like <script nonce="{{.nonce}}">.
+func (this *Context) CSPNonce() string {
+	if nonce, ok := this.metaInternal.Load(_CSP_NONCE_META_KEY); ok {
+		return nonce.(string)
+	}
+	return ""
+}
+
+func newCSPNonce() (string, error) {
+	b := make([]byte, _CSP_NONCE_BYTES)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,165 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecureHeaders(t *testing.T) {
+	csp := NewCSP().Add("default-src", "'self'").Add("script-src", "'self'", CSPNonce).Add("upgrade-insecure-requests")
+	s := New("")
+	s.SetTrustedProxies("127.0.0.1", "::1")
+	s.Use(SecureHeaders(SecureHeadersOptions{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		CSP:                   csp,
+		FrameOptions:          "sameorigin",
+		PermissionsPolicy:     "camera=()",
+	}))
+	s.GET("/", func(c *Context) {
+		c.Text(c.CSPNonce())
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	nonces := map[string]bool{}
+	for _, proto := range []string{"http", "https", "https"} {
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		req.Header.Set("X-Forwarded-Proto", proto)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		nonce := string(body)
+		if nonce == "" || nonces[nonce] {
+			t.Error("nonce", nonce)
+		}
+		nonces[nonce] = true
+
+		header := res.Header
+		expect := "default-src 'self'; script-src 'self' 'nonce-" + nonce + "'; upgrade-insecure-requests; frame-ancestors 'self'"
+		if header.Get("Content-Security-Policy") != expect {
+			t.Error(header.Get("Content-Security-Policy"))
+		}
+		if header.Get("X-Content-Type-Options") != "nosniff" || header.Get("X-Frame-Options") != "SAMEORIGIN" ||
+			header.Get("Referrer-Policy") != "strict-origin-when-cross-origin" || header.Get("Permissions-Policy") != "camera=()" {
+			t.Error(header)
+		}
+		hsts := ""
+		if proto == "https" {
+			hsts = "max-age=31536000; includeSubDomains"
+		}
+		if header.Get("Strict-Transport-Security") != hsts {
+			t.Error(proto, header.Get("Strict-Transport-Security"))
+		}
+	}
+	// the CSP given is not changed
+	if csp.Has("frame-ancestors") {
+		t.Error(csp)
+	}
+
+	// report only, without nonce
+	s = New("")
+	s.Use(SecureHeaders(SecureHeadersOptions{
+		CSP:            NewCSP().Add("default-src", "'self'").Add("frame-ancestors", "https://example.com"),
+		CSPReportOnly:  true,
+		FrameOptions:   "-",
+		ReferrerPolicy: "no-referrer",
+	}))
+	s.GET("/", func(c *Context) {
+		c.Text(c.CSPNonce())
+	})
+	ts2 := s.RunTest()
+	defer ts2.Close()
+	res, err := http.Get(ts2.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	header := res.Header
+	if len(body) != 0 || header.Get("Content-Security-Policy") != "" || header.Get("X-Frame-Options") != "" ||
+		header.Get("Content-Security-Policy-Report-Only") != "default-src 'self'; frame-ancestors https://example.com" ||
+		header.Get("Referrer-Policy") != "no-referrer" {
+		t.Error(string(body), header)
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	noRedirect := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("should panic without the host redirected to")
+			}
+		}()
+		SecureHeaders(SecureHeadersOptions{HTTPSRedirect: true})
+	}()
+
+	newServer := func(trusted bool, opts SecureHeadersOptions) *Server {
+		s := New("")
+		if trusted {
+			s.SetTrustedProxies("127.0.0.1", "::1")
+		}
+		opts.HTTPSRedirect = true
+		opts.RedirectSkipPaths = []string{"/health"}
+		s.Use(SecureHeaders(opts))
+		s.GET("/*path", func(c *Context) {
+			c.Text("ok")
+		})
+		return s
+	}
+
+	fixed := SecureHeadersOptions{HTTPSHost: "example.com"}
+	allowed := SecureHeadersOptions{RedirectHosts: []string{"example.com", "www.example.com"}}
+	cases := []struct {
+		trusted  bool
+		opts     SecureHeadersOptions
+		host     string
+		path     string
+		header   map[string]string
+		status   int
+		location string
+	}{
+		{false, fixed, "example.com:8080", "/a?b=1", nil, 308, "https://example.com/a?b=1"},
+		// not from a trusted proxy
+		{false, fixed, "example.com:8080", "/a", map[string]string{"X-Forwarded-Proto": "https"}, 308, "https://example.com/a"},
+		{true, fixed, "example.com:8080", "/a", map[string]string{"X-Forwarded-Proto": "https"}, 200, ""},
+		{true, fixed, "example.com:8080", "/a", map[string]string{"X-Forwarded-Proto": "http"}, 308, "https://example.com/a"},
+		{true, fixed, "example.com:8080", "/a", map[string]string{"Forwarded": "for=1.2.3.4;proto=https"}, 200, ""},
+		{true, SecureHeadersOptions{HTTPSHost: "example.com:8443"}, "example.com:8080", "/a", nil, 308, "https://example.com:8443/a"},
+		{false, fixed, "example.com:8080", "/health", nil, 200, ""},
+		// the Host header is not redirected to
+		{false, fixed, "evil.com", "/a", nil, 308, "https://example.com/a"},
+		{false, allowed, "WWW.example.com:8080", "/a", nil, 308, "https://www.example.com/a"},
+		{false, allowed, "evil.com", "/a", nil, 400, ""},
+		{false, SecureHeadersOptions{HTTPSHost: "example.com", RedirectHosts: []string{"www.example.com"}}, "evil.com", "/a", nil, 308, "https://example.com/a"},
+	}
+	for i, tc := range cases {
+		ts := newServer(tc.trusted, tc.opts).RunTest()
+		req, _ := http.NewRequest("GET", ts.URL+tc.path, nil)
+		req.Host = tc.host
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		res, err := noRedirect.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		ts.Close()
+		if res.StatusCode != tc.status || res.Header.Get("Location") != tc.location {
+			t.Error(i, res.StatusCode, res.Header.Get("Location"))
+		}
+		if tc.status == 200 && !strings.Contains(res.Header.Get("X-Content-Type-Options"), "nosniff") {
+			t.Error(i, res.Header)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"git.lcgc.work/platform/kelp/listener"
+)
+
+const _DEFAULT_SHUTDOWN_TIMEOUT = 30 * time.Second
+
+// SetTimeout sets the read, write and idle timeout of connections,
+// 0 means no timeout.
+func (this *Server) SetTimeout(read, write, idle time.Duration) {
+	this.readTimeout = read
+	this.writeTimeout = write
+	this.idleTimeout = idle
+}
+
+// SetMaxHeaderBytes sets the max size of request headers,
+// 0 means http.DefaultMaxHeaderBytes.
+func (this *Server) SetMaxHeaderBytes(n int) {
+	this.maxHeaderBytes = n
+}
+
+// SetShutdownTimeout sets how long Run waits for running handlers on SIGTERM
+func (this *Server) SetShutdownTimeout(timeout time.Duration) {
+	this.shutdownTimeout = timeout
+}
+
+// RunTLS is like Run but serves https, http/2 is enabled.
+// The certificate is reloaded when the files are modified.
+func (this *Server) RunTLS(certFile, keyFile string) {
+	ctx, cancel := signalContext()
+	defer cancel()
+	if err := this.RunTLSContext(ctx, certFile, keyFile); err != nil {
+		panic("web server start faild " + err.Error())
+	}
+}
+
+// RunContext serves until ctx is done, then shuts down gracefully.
+// The host can be any address supported by listener.Listen,
+// such as "127.0.0.1:9999", "unix:///path/to/app.sock" or "systemd://".
+func (this *Server) RunContext(ctx context.Context) error {
+	ln, err := listener.Listen(this.host)
+	if err != nil {
+		return err
+	}
+	return this.serveListener(ctx, ln, nil)
+}
+
+// RunListener is like RunContext but serves on a listener opened by caller
+func (this *Server) RunListener(ctx context.Context, ln net.Listener) error {
+	return this.serveListener(ctx, ln, nil)
+}
+
+func (this *Server) RunTLSContext(ctx context.Context, certFile, keyFile string) error {
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	ln, err := listener.Listen(this.host)
+	if err != nil {
+		return err
+	}
+	return this.serveListener(ctx, ln, &tls.Config{GetCertificate: reloader.GetCertificate})
+}
+
+// shutdownState is done when the running server is shut down, by ctx or by Shutdown
+type shutdownState struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func (this *shutdownState) finish(err error) {
+	this.once.Do(func() {
+		this.err = err
+		close(this.done)
+	})
+}
+
+// Shutdown stops accepting new connections,
+// and waits for running handlers at most timeout.
+// Run and RunContext return after it is done.
+func (this *Server) Shutdown(timeout time.Duration) error {
+	this.mux.Lock()
+	httpServer, stopping := this.httpServer, this.stopping
+	this.mux.Unlock()
+	if httpServer == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	log.Debug("web server shutting down", this.host)
+	err := httpServer.Shutdown(ctx)
+	stopping.finish(err)
+	return err
+}
+
+func (this *Server) serveListener(ctx context.Context, ln net.Listener, tlsConfig *tls.Config) error {
+	httpServer := &http.Server{
+		Handler:        this,
+		TLSConfig:      tlsConfig,
+		ReadTimeout:    this.readTimeout,
+		WriteTimeout:   this.writeTimeout,
+		IdleTimeout:    this.idleTimeout,
+		MaxHeaderBytes: this.maxHeaderBytes,
+	}
+	stopping := &shutdownState{done: make(chan struct{})}
+	this.mux.Lock()
+	this.httpServer = httpServer
+	this.stopping = stopping
+	this.start = time.Now()
+	this.mux.Unlock()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+			return
+		}
+		timeout := this.shutdownTimeout
+		if timeout <= 0 {
+			timeout = _DEFAULT_SHUTDOWN_TIMEOUT
+		}
+		this.Shutdown(timeout)
+	}()
+
+	log.Debug("web server listen on", ln.Addr())
+	var err error
+	if tlsConfig != nil {
+		err = httpServer.ServeTLS(ln, "", "")
+	} else {
+		err = httpServer.Serve(ln)
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	// wait for running handlers, the shutdown is started by ctx or by Shutdown
+	<-stopping.done
+	return stopping.err
+}
+
+// signalContext is done on SIGTERM or SIGINT
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		select {
+		case sig := <-c:
+			log.Info("web server receive signal", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(c)
+	}()
+	return ctx, cancel
+}
+
+// certReloader loads the certificate again when the files are modified
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mux     sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := reloader.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (this *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	modTime, err := this.lastModified()
+	if err != nil {
+		return nil, err
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if this.cert != nil && !modTime.After(this.modTime) {
+		return this.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(this.certFile, this.keyFile)
+	if err != nil {
+		if this.cert != nil {
+			// keep the old one while the files are being written
+			log.Error("reload certificate faild", err)
+			return this.cert, nil
+		}
+		return nil, err
+	}
+	log.Info("load certificate", this.certFile, modTime)
+	this.cert = &cert
+	this.modTime = modTime
+	return this.cert, nil
+}
+
+func (this *certReloader) lastModified() (time.Time, error) {
+	modTime := time.Time{}
+	for _, file := range []string{this.certFile, this.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTime, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
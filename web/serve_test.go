@@ -0,0 +1,246 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	s := New("127.0.0.1:9998")
+	s.SetTimeout(5*time.Second, 5*time.Second, time.Minute)
+	s.GET("/slow", func(c *Context) {
+		time.Sleep(500 * time.Millisecond)
+		c.Success("done")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- s.RunContext(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan string)
+	go func() {
+		resp, err := Get("http://127.0.0.1:9998/slow")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- string(resp)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	if resp := <-done; resp != `{"data":"done","status":0}` {
+		t.Error(resp)
+	}
+	if err := <-stopped; err != nil {
+		t.Error(err)
+	}
+	if _, err := Get("http://127.0.0.1:9998/slow"); err == nil {
+		t.Error("server should be closed")
+	}
+}
+
+func writeTestCert(t *testing.T, dir string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	// make sure the modification time changes
+	modTime := time.Now().Add(time.Duration(serial) * time.Second)
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+	return certFile, keyFile
+}
+
+func TestRunTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kelp-web-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir, 1)
+
+	s := New("127.0.0.1:9997")
+	s.GET("/tls", func(c *Context) {
+		c.Success(c.Request.Proto)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.RunTLSContext(ctx, certFile, keyFile)
+	time.Sleep(100 * time.Millisecond)
+
+	serial := func() (int64, string) {
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+		}}
+		res, err := client.Get("https://127.0.0.1:9997/tls")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		resp, _ := ioutil.ReadAll(res.Body)
+		return res.TLS.PeerCertificates[0].SerialNumber.Int64(), string(resp)
+	}
+	if n, resp := serial(); n != 1 || resp != `{"data":"HTTP/2.0","status":0}` {
+		t.Error(n, resp)
+	}
+	writeTestCert(t, dir, 2)
+	if n, _ := serial(); n != 2 {
+		t.Error("certificate should be reloaded", n)
+	}
+}
+
+func TestRunListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kelp-web-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "web.sock")
+
+	s := New("unix://" + sock)
+	s.GET("/unix", func(c *Context) {
+		c.Success("unix")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.RunContext(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+	res, err := client.Get("http://unix/unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	resp, _ := ioutil.ReadAll(res.Body)
+	if string(resp) != `{"data":"unix","status":0}` {
+		t.Error(string(resp))
+	}
+}
+
+func TestUnixTrustedProxy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kelp-web-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	client := func(sock string) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return net.Dial("unix", sock)
+			},
+		}}
+	}
+
+	for i, trusted := range []bool{true, false} {
+		sock := filepath.Join(dir, fmt.Sprintf("web%d.sock", i))
+		s := New("unix://" + sock)
+		if trusted {
+			s.SetTrustedProxies("unix")
+		} else {
+			// ip ranges do not match unix peers
+			s.SetTrustedProxies("0.0.0.0/0", "::/0")
+		}
+		s.GET("/ip", func(c *Context) {
+			c.Text(c.ClientIP(), " ", c.Scheme())
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		go s.RunContext(ctx)
+		time.Sleep(100 * time.Millisecond)
+
+		req, _ := http.NewRequest("GET", "http://unix/ip", nil)
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		res, err := client(sock).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		cancel()
+		expect := "1.2.3.4 https"
+		if !trusted {
+			expect = "@ http"
+		}
+		if string(resp) != expect {
+			t.Error(trusted, string(resp))
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s := New("127.0.0.1:9997")
+	s.GET("/slow", func(c *Context) {
+		time.Sleep(300 * time.Millisecond)
+		c.Success("done")
+	})
+	stopped := make(chan error)
+	go func() {
+		stopped <- s.RunContext(context.Background())
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	done := make(chan string)
+	go func() {
+		resp, err := Get("http://127.0.0.1:9997/slow")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- string(resp)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := s.Shutdown(time.Second); err != nil {
+		t.Error(err)
+	}
+	if resp := <-done; resp != `{"data":"done","status":0}` {
+		t.Error(resp)
+	}
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RunContext does not return after Shutdown")
+	}
+}
@@ -2,11 +2,15 @@ package web
 
 import (
 	"fmt"
+	"html/template"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,6 +20,27 @@ type Server struct {
 
 	session *_SessionServer
 	start   time.Time
+
+	exposeRoutes   bool
+	trustedProxies []*net.IPNet
+	trustUnixProxy bool
+
+	html      map[string]*template.Template
+	htmlFuncs template.FuncMap
+
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	maxHeaderBytes  int
+	shutdownTimeout time.Duration
+
+	mux        sync.Mutex
+	httpServer *http.Server
+	stopping   *shutdownState
+
+	noRoute      []HandlerFunc
+	noMethod     []HandlerFunc
+	panicHandler func(*Context, interface{})
 }
 
 func New(host string) *Server {
@@ -23,32 +48,42 @@ func New(host string) *Server {
 		host: host,
 		router: &Router{
 			path:         "",
-			realPath:     host,
+			realPath:     "",
 			method:       "",
 			handlerChain: []HandlerFunc{},
 			children:     []*Router{},
+			trees:        map[string]*node{},
+			names:        map[string]*Router{},
+			maxBodyBytes: _DEFAULT_MAX_BODY_BYTES,
 		},
+		noRoute:  []HandlerFunc{notFoundHandler},
+		noMethod: []HandlerFunc{methodNotAllowedHandler},
 	}
 }
 
 func (this *Server) Print() {
-	fmt.Println(this.router.children[0].children[0])
+	for _, route := range this.Routes() {
+		fmt.Println(route.Method, route.Path, route.Name, strings.Join(route.Handlers, " "))
+	}
 }
 
 func (this *Server) RunTest() *httptest.Server {
 	return httptest.NewServer(this)
 }
 
+// Run serves until SIGTERM or SIGINT, then shuts down gracefully
 func (this *Server) Run() {
-	this.start = time.Now()
-	err := http.ListenAndServe(this.host, this)
-	if err != nil {
+	ctx, cancel := signalContext()
+	defer cancel()
+	if err := this.RunContext(ctx); err != nil {
 		panic("web server start faild " + err.Error())
 	}
 }
 
 func (this *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	c := newContext(w, req)
+	c.server = this
+	defer c.removeMultipartForm()
 	this.handle(c)
 }
 
@@ -58,16 +93,115 @@ func (this *Server) handle(c *Context) {
 		this.metric(c)
 		return
 	}
+	if path == "/_kelp/routes" && this.exposeRoutes {
+		c.Json(this.Routes())
+		return
+	}
 	httpMethod := c.Request.Method
 	router, params := this.router.find(httpMethod, path)
-	if router == nil || len(router.handlerChain) <= 0 {
-		c.DieWithHttpStatus(404)
+	if router == nil && httpMethod == http.MethodHead {
+		// answer HEAD with the GET router, net/http drops the body
+		router, params = this.router.find(http.MethodGet, path)
+	}
+	if router != nil && len(router.handlerChain) > 0 {
+		c.Params = params
+		if !c.limitBody(router.bodyLimit()) || !c.readJSONBody() {
+			this.serve(c, this.withMiddleware(bodyTooLargeHandler))
+			return
+		}
+		this.serve(c, router.handlerChain)
+		return
+	}
+	if !c.limitBody(this.router.bodyLimit()) {
+		this.serve(c, this.withMiddleware(bodyTooLargeHandler))
+		return
+	}
+	if allow := this.router.allowed(path); len(allow) > 0 {
+		c.ResponseWriter.Header().Set("Allow", strings.Join(allow, ", "))
+		if httpMethod == http.MethodOptions {
+			this.serve(c, this.optionsChain(c, path, allow))
+		} else {
+			this.serve(c, this.withMiddleware(this.noMethod...))
+		}
 		return
 	}
-	c.Params = params
-	c.handlerChain = router.handlerChain
+	this.serve(c, this.withMiddleware(this.noRoute...))
+}
+
+func (this *Server) serve(c *Context, handlerChain []HandlerFunc) {
+	c.handlerChain = handlerChain
 	c.handlerIndex = 0
-	c.handlerChain[c.handlerIndex](c)
+	if len(c.handlerChain) > 0 {
+		c.handlerChain[c.handlerIndex](c)
+	}
+}
+
+// optionsChain answers the automatic OPTIONS. For a CORS preflight, only the CORS handlers
+// of the router for the requested method run, so a group using CORS answers preflights,
+// and other middleware such as auth or rate limit does not reject them.
+func (this *Server) optionsChain(c *Context, path string, allow []string) []HandlerFunc {
+	requested := c.Request.Header.Get("Access-Control-Request-Method")
+	if requested == "" {
+		return this.withMiddleware(optionsHandler)
+	}
+	target := this.router
+	for _, method := range append([]string{requested}, allow...) {
+		if method == http.MethodOptions {
+			continue
+		}
+		if router, params := this.router.find(method, path); router != nil {
+			c.Params = params
+			target = router
+			break
+		}
+	}
+	handlerChain := target.corsChain()
+	if len(handlerChain) == 0 {
+		// CORS is not added by Router.CORS, it may be anywhere in the middleware
+		handlerChain = target.middlewareChain()
+	}
+	return append(append([]HandlerFunc{}, handlerChain...), optionsHandler)
+}
+
+// withMiddleware appends handlers to the handlers used by server
+func (this *Server) withMiddleware(handlers ...HandlerFunc) []HandlerFunc {
+	handlerChain := append([]HandlerFunc{}, this.router.handlerChain...)
+	return append(handlerChain, handlers...)
+}
+
+// NoRoute sets the handlers called when no router matches the path,
+// they run after the handlers used by server, default responds 404.
+func (this *Server) NoRoute(handlers ...HandlerFunc) {
+	this.noRoute = append([]HandlerFunc{}, handlers...)
+}
+
+// NoMethod sets the handlers called when the path matches routers of other methods,
+// they run after the handlers used by server, default responds 405.
+// The Allow header is already set before they are called.
+func (this *Server) NoMethod(handlers ...HandlerFunc) {
+	this.noMethod = append([]HandlerFunc{}, handlers...)
+}
+
+// OnPanic sets the handler called by RecoveryHandler after a panic recovered,
+// default responds 500.
+func (this *Server) OnPanic(handler func(c *Context, err interface{})) {
+	this.panicHandler = handler
+}
+
+func notFoundHandler(c *Context) {
+	c.DieWithHttpStatus(404)
+}
+
+func methodNotAllowedHandler(c *Context) {
+	c.DieWithHttpStatus(405)
+}
+
+func bodyTooLargeHandler(c *Context) {
+	c.DieWithHttpStatus(413)
+}
+
+func optionsHandler(c *Context) {
+	c.DieWithHttpStatus(204)
 }
 
 func (this *Server) Group(path string) *Router {
@@ -78,6 +212,10 @@ func (this *Server) Use(handler HandlerFunc) *Router {
 	return this.router.Use(handler)
 }
 
+func (this *Server) CORS(opts CORSOptions) *Router {
+	return this.router.CORS(opts)
+}
+
 func (this *Server) GET(path string, handler ...HandlerFunc) *Router {
 	return this.router.GET(path, handler...)
 }
@@ -94,6 +232,34 @@ func (this *Server) DELETE(path string, handler ...HandlerFunc) *Router {
 	return this.router.DELETE(path, handler...)
 }
 
+func (this *Server) PATCH(path string, handler ...HandlerFunc) *Router {
+	return this.router.PATCH(path, handler...)
+}
+
+func (this *Server) HEAD(path string, handler ...HandlerFunc) *Router {
+	return this.router.HEAD(path, handler...)
+}
+
+func (this *Server) OPTIONS(path string, handler ...HandlerFunc) *Router {
+	return this.router.OPTIONS(path, handler...)
+}
+
+func (this *Server) Any(path string, handler ...HandlerFunc) []*Router {
+	return this.router.Any(path, handler...)
+}
+
+func (this *Server) Handle(method, path string, handler ...HandlerFunc) *Router {
+	return this.router.Handle(method, path, handler...)
+}
+
+// URL builds the path of the router named name, see Router.Name
+//
+//	server.GET("/user/:id", handler).Name("user.show")
+//	path, err := server.URL("user.show", "id", "42") // "/user/42"
+func (this *Server) URL(name string, params ...string) (string, error) {
+	return this.router.url(name, params...)
+}
+
 func (this *Server) metric(c *Context) {
 	ret := map[string]interface{}{}
 	ret["hostname"] = os.Getenv("HOSTNAME")
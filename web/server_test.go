@@ -1,8 +1,11 @@
 package web
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
@@ -143,3 +146,387 @@ func TestPostForm(t *testing.T) {
 		t.Error(string(resp))
 	}
 }
+
+func TestMethodNotAllowed(t *testing.T) {
+	server.GET("/method", func(c *Context) {
+		c.Success("get")
+	})
+	server.Any("/method-any", func(c *Context) {
+		c.Success(c.Request.Method)
+	})
+	cases := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{"GET", "/method", 200, ""},
+		{"HEAD", "/method", 200, ""},
+		{"POST", "/method", 405, "GET, HEAD, OPTIONS"},
+		{"OPTIONS", "/method", 204, "GET, HEAD, OPTIONS"},
+		{"PATCH", "/method-any", 200, ""},
+		{"POST", "/method-not-found", 404, ""},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, "http://127.0.0.1:9999"+c.path, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		res.Body.Close()
+		if res.StatusCode != c.status {
+			t.Error(c.method, c.path, "status", res.StatusCode, "expect", c.status)
+		}
+		if allow := res.Header.Get("Allow"); allow != c.allow {
+			t.Error(c.method, c.path, "allow", allow, "expect", c.allow)
+		}
+	}
+}
+
+func TestErrorHandlers(t *testing.T) {
+	s := New("")
+	s.Use(func(c *Context) {
+		c.ResponseWriter.Header().Set("X-Middleware", "1")
+		c.Next()
+	})
+	s.Use(RecoveryHandler)
+	s.NoRoute(func(c *Context) {
+		c.Error(404, "not found")
+	})
+	s.NoMethod(func(c *Context) {
+		c.Error(405, c.ResponseWriter.Header().Get("Allow"))
+	})
+	s.OnPanic(func(c *Context, err interface{}) {
+		c.Error(500, err)
+	})
+	s.GET("/panic", func(c *Context) {
+		panic("oops")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+	cases := []struct {
+		method string
+		path   string
+		resp   string
+	}{
+		{"GET", "/not-found", `{"message":"not found","status":404}`},
+		{"POST", "/panic", `{"message":"GET, HEAD, OPTIONS","status":405}`},
+		{"GET", "/panic", `{"message":"oops","status":500}`},
+		{"OPTIONS", "/panic", ``},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, ts.URL+c.path, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		resp, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if string(resp) != c.resp {
+			t.Error(c.method, c.path, string(resp))
+		}
+		if res.Header.Get("X-Middleware") != "1" {
+			t.Error(c.method, c.path, "middleware not called")
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	s := New("")
+	s.Use(RecoveryHandler)
+	s.GET("/user/:id", LogHandler).Name("user.show")
+	s.Group("/admin").POST("/login", LogHandler)
+	routes := s.Routes()
+	if len(routes) != 2 {
+		t.Fatal(routes)
+	}
+	if routes[0].Method != "GET" || routes[0].Path != "/user/:id" || routes[0].Name != "user.show" {
+		t.Error(routes[0])
+	}
+	if routes[1].Method != "POST" || routes[1].Path != "/admin/login" || routes[1].Name != "" {
+		t.Error(routes[1])
+	}
+	handlers := routes[0].Handlers
+	if len(handlers) != 2 || !strings.HasSuffix(handlers[0], "web.RecoveryHandler") || !strings.HasSuffix(handlers[1], "web.LogHandler") {
+		t.Error(handlers)
+	}
+
+	ts := s.RunTest()
+	defer ts.Close()
+	if res, _ := http.Get(ts.URL + "/_kelp/routes"); res.StatusCode != 404 {
+		t.Error("routes should not be exposed", res.StatusCode)
+	}
+	s.ExposeRoutes()
+	res, err := http.Get(ts.URL + "/_kelp/routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := ioutil.ReadAll(res.Body)
+	if !strings.HasPrefix(string(resp), `[{"method":"GET","path":"/user/:id","name":"user.show","handlers":[`) {
+		t.Error(string(resp))
+	}
+}
+
+func TestAbortWithJSON(t *testing.T) {
+	s := New("")
+	s.Use(func(c *Context) {
+		c.Next()
+		if !c.IsAborted() {
+			t.Error("should be aborted")
+		}
+	})
+	s.GET("/abort", func(c *Context) {
+		c.AbortWithJSON(403, map[string]interface{}{"status": 403})
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+	res, err := http.Get(ts.URL + "/abort")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != 403 || string(resp) != `{"status":403}` {
+		t.Error(res.StatusCode, string(resp))
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	s := New("")
+	type record struct {
+		status int
+		size   int64
+	}
+	records := make(chan record, 1)
+	s.Use(func(c *Context) {
+		c.Next()
+		if c.Written() && c.TimeToFirstByte() <= 0 {
+			t.Error("time to first byte is not recorded")
+		}
+		records <- record{c.HttpStatus, c.ResponseSize()}
+	})
+	s.GET("/write", func(c *Context) {
+		c.ResponseWriter.Write([]byte("hello"))
+	})
+	s.GET("/text", func(c *Context) {
+		c.Text("hi")
+	})
+	s.GET("/redirect", func(c *Context) {
+		http.Redirect(c.ResponseWriter, c.Request, "/text", 301)
+	})
+	s.GET("/status", func(c *Context) {
+		c.ResponseWriter.WriteHeader(202)
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	cases := map[string]record{
+		"/write":    {200, 5},
+		"/text":     {200, 2},
+		"/redirect": {301, -1},
+		"/status":   {202, 0},
+	}
+	for path, expect := range cases {
+		res, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		got := <-records
+		if got.status != expect.status || (expect.size >= 0 && got.size != expect.size) {
+			t.Error(path, got)
+		}
+	}
+
+	c := newContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if err := http.NewResponseController(c.ResponseWriter).Flush(); err != nil || !flushable(c.ResponseWriter) {
+		t.Error("flusher is not passed through", err)
+	}
+	// the wrapped writer can not flush, hijack or push
+	c = newContext(struct{ http.ResponseWriter }{httptest.NewRecorder()}, httptest.NewRequest("GET", "/", nil))
+	if err := http.NewResponseController(c.ResponseWriter).Flush(); err != http.ErrNotSupported || flushable(c.ResponseWriter) {
+		t.Error(err)
+	}
+	if _, _, err := c.ResponseWriter.(http.Hijacker).Hijack(); err != http.ErrNotSupported {
+		t.Error(err)
+	}
+	if err := c.ResponseWriter.(http.Pusher).Push("/a.js", nil); err != http.ErrNotSupported {
+		t.Error(err)
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	s := New("")
+	s.Use(RequestId())
+	s.GET("/id", func(c *Context) {
+		c.Text(c.RequestId())
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	cases := map[string]bool{
+		"abc-123": true,
+		"":        false,
+		"bad id!": false,
+	}
+	for id, accepted := range cases {
+		req, _ := http.NewRequest("GET", ts.URL+"/id", nil)
+		if id != "" {
+			req.Header.Set("X-Request-Id", id)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		got := res.Header.Get("X-Request-Id")
+		if got != string(body) || (accepted && got != id) || (!accepted && len(got) != 32) {
+			t.Error(id, got, string(body))
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s := New("")
+	s.Use(RecoveryHandler)
+	s.Use(Timeout(50 * time.Millisecond))
+	var _ context.Context = &Context{}
+	s.GET("/slow", func(c *Context) {
+		select {
+		case <-c.Done():
+		case <-time.After(time.Second):
+			t.Error("context is not done after deadline")
+		}
+		if _, ok := c.Deadline(); !ok || c.Err() != context.DeadlineExceeded {
+			t.Error(c.Err())
+		}
+	})
+	writeErr := make(chan error, 1)
+	// ignores the context
+	s.GET("/sleep", func(c *Context) {
+		c.ResponseWriter.Header().Set("X-Sleep", "1")
+		time.Sleep(300 * time.Millisecond)
+		_, err := c.ResponseWriter.Write([]byte("late"))
+		writeErr <- err
+	})
+	s.GET("/fast", func(c *Context) {
+		c.ResponseWriter.Header().Set("X-Fast", "1")
+		c.Text("ok")
+	})
+	s.GET("/panic", func(c *Context) {
+		panic("oops")
+	})
+	s.GRPC("/grpc", func(ctx context.Context, param *struct{}) (*struct{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	cases := map[string]int{
+		"GET /slow":  503,
+		"GET /sleep": 503,
+		"GET /fast":  200,
+		"GET /panic": 500,
+		"POST /grpc": 503,
+	}
+	for route, status := range cases {
+		parts := strings.Split(route, " ")
+		req, _ := http.NewRequest(parts[0], ts.URL+parts[1], strings.NewReader("{}"))
+		start := time.Now()
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != status {
+			t.Error(route, res.StatusCode)
+		}
+		switch parts[1] {
+		case "/sleep":
+			// responded at the deadline, not after the handler returns
+			if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+				t.Error(route, elapsed)
+			}
+			if res.Header.Get("X-Sleep") != "" || string(body) == "late" {
+				t.Error(route, res.Header, string(body))
+			}
+			if err := <-writeErr; err != http.ErrHandlerTimeout {
+				t.Error(route, err)
+			}
+		case "/fast":
+			if res.Header.Get("X-Fast") != "1" || string(body) != "ok" {
+				t.Error(route, res.Header, string(body))
+			}
+		}
+	}
+}
+
+type errorLogger struct {
+	quietLogger
+	errors chan string
+}
+
+func (lg *errorLogger) Error(msg ...interface{}) {
+	select {
+	case lg.errors <- fmt.Sprint(msg...):
+	default:
+	}
+}
+
+func TestTimeoutAfterDeadline(t *testing.T) {
+	logger := &errorLogger{errors: make(chan string, 1)}
+	defer SetLogger(log)
+	SetLogger(logger)
+	s := New("")
+	s.Use(RecoveryHandler)
+	s.Use(func(c *Context) {
+		c.Set("outer", "before")
+		c.Next()
+		c.Set("outer", "after")
+	})
+	s.Use(Timeout(20 * time.Millisecond))
+	finished := make(chan interface{}, 1)
+	s.GET("/set", func(c *Context) {
+		<-c.Done()
+		time.Sleep(20 * time.Millisecond)
+		// written after the outer middleware returns
+		c.Set("inner", true)
+		finished <- c.MustGet("outer")
+	})
+	s.GET("/panic", func(c *Context) {
+		<-c.Done()
+		time.Sleep(20 * time.Millisecond)
+		panic("late")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	for _, path := range []string{"/set", "/panic"} {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 503 {
+			t.Error(path, res.StatusCode)
+		}
+	}
+	if outer := <-finished; outer != "before" {
+		t.Error(outer)
+	}
+	select {
+	case msg := <-logger.errors:
+		if !strings.Contains(msg, "late") {
+			t.Error(msg)
+		}
+	case <-time.After(time.Second):
+		t.Error("panic after timeout is not logged")
+	}
+}
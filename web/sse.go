@@ -0,0 +1,173 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const _SSE_KEEP_ALIVE = 15 * time.Second
+
+// SSEEvent is a server-sent event,
+// Data is sent as it is if it is a string or []byte, otherwise as json.
+type SSEEvent struct {
+	Id    string
+	Event string
+	Data  interface{}
+	Retry time.Duration
+}
+
+type SSEWriter struct {
+	ctx         context.Context
+	w           http.ResponseWriter
+	flusher     http.Flusher
+	lastEventId string
+
+	mux       sync.Mutex
+	keepAlive *time.Ticker
+	interval  time.Duration
+}
+
+// SSE streams server-sent events until handler returns or the client disconnects,
+// a keep-alive comment is sent every 15 seconds if there is no event.
+//
+//	c.SSE(func(w *web.SSEWriter) error {
+//		for {
+//			select {
+//			case <-w.Done():
+//				return nil
+//			case progress := <-ch:
+//				if err := w.Send(web.SSEEvent{Event: "progress", Data: progress}); err != nil {
+//					return err
+//				}
+//			}
+//		}
+//	})
+func (this *Context) SSE(handler func(w *SSEWriter) error) error {
+	flusher, ok := this.ResponseWriter.(http.Flusher)
+	if !ok || !flushable(this.ResponseWriter) {
+		return this.renderFailed("sse", errors.New("response writer does not support flush"))
+	}
+	header := this.ResponseWriter.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// disable the buffering of nginx
+	header.Set("X-Accel-Buffering", "no")
+	this.HttpStatus = 200
+	this.ResponseWriter.WriteHeader(200)
+	flusher.Flush()
+
+	w := &SSEWriter{
+		ctx:         this.Request.Context(),
+		w:           this.ResponseWriter,
+		flusher:     flusher,
+		lastEventId: this.Request.Header.Get("Last-Event-ID"),
+		keepAlive:   time.NewTicker(_SSE_KEEP_ALIVE),
+		interval:    _SSE_KEEP_ALIVE,
+	}
+	defer w.keepAlive.Stop()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		// no keep-alive should be written after the handler returns
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-w.ctx.Done():
+				return
+			case <-w.keepAlive.C:
+				if err := w.Comment("keep-alive"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return handler(w)
+}
+
+// LastEventId is the Last-Event-ID header sent by a reconnecting client,
+// events after it should be sent again.
+func (this *SSEWriter) LastEventId() string {
+	return this.lastEventId
+}
+
+// Done is closed when the client disconnects
+func (this *SSEWriter) Done() <-chan struct{} {
+	return this.ctx.Done()
+}
+
+// SetKeepAlive changes the interval of keep-alive comments
+func (this *SSEWriter) SetKeepAlive(interval time.Duration) {
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	this.interval = interval
+	this.keepAlive.Reset(interval)
+}
+
+func (this *SSEWriter) Send(event SSEEvent) error {
+	var data string
+	switch d := event.Data.(type) {
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		out, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		data = string(out)
+	}
+	buf := &strings.Builder{}
+	if event.Id != "" {
+		fmt.Fprintf(buf, "id: %s\n", sseLine(event.Id))
+	}
+	if event.Event != "" {
+		fmt.Fprintf(buf, "event: %s\n", sseLine(event.Event))
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(buf, "retry: %d\n", event.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		fmt.Fprintf(buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+	return this.write(buf.String())
+}
+
+// Comment sends a comment line which is ignored by clients
+func (this *SSEWriter) Comment(text string) error {
+	return this.write(": " + sseLine(text) + "\n\n")
+}
+
+func (this *SSEWriter) write(s string) error {
+	if err := this.ctx.Err(); err != nil {
+		return err
+	}
+	this.mux.Lock()
+	defer this.mux.Unlock()
+	if _, err := this.w.Write([]byte(s)); err != nil {
+		return err
+	}
+	this.flusher.Flush()
+	// no keep-alive is needed right after an event
+	this.keepAlive.Reset(this.interval)
+	return nil
+}
+
+// sseLine removes line breaks which would break the event
+func sseLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,69 @@
+package web
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+	s := New("")
+	stopped := make(chan error, 1)
+	s.GET("/events", func(c *Context) {
+		stopped <- c.SSE(func(w *SSEWriter) error {
+			w.SetKeepAlive(50 * time.Millisecond)
+			if err := w.Send(SSEEvent{Id: "1", Event: "resume", Data: w.LastEventId()}); err != nil {
+				return err
+			}
+			if err := w.Send(SSEEvent{Id: "2", Data: map[string]int{"progress": 50}}); err != nil {
+				return err
+			}
+			if err := w.Send(SSEEvent{Data: "line1\nline2", Retry: time.Second}); err != nil {
+				return err
+			}
+			<-w.Done()
+			return w.Send(SSEEvent{Data: "closed"})
+		})
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/events", nil)
+	req.Header.Set("Last-Event-ID", "0")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Header.Get("Content-Type") != "text/event-stream" || res.Header.Get("Cache-Control") != "no-cache" {
+		t.Error(res.Header)
+	}
+	reader := bufio.NewReader(res.Body)
+	lines := []string{}
+	for len(lines) < 12 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	expect := strings.Join([]string{
+		"id: 1", "event: resume", "data: 0", "",
+		"id: 2", `data: {"progress":50}`, "",
+		"retry: 1000", "data: line1", "data: line2", "",
+		": keep-alive",
+	}, "|")
+	if strings.Join(lines, "|") != expect {
+		t.Error(strings.Join(lines, "|"))
+	}
+	res.Body.Close()
+	select {
+	case err := <-stopped:
+		if err == nil {
+			t.Error("send after disconnect should fail")
+		}
+	case <-time.After(time.Second):
+		t.Error("handler should stop when client disconnects")
+	}
+}
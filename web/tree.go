@@ -0,0 +1,165 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+)
+
+// node is a compressed radix tree node, one tree per http method.
+// A node matches:
+//
+//	static:   its path as a prefix, children are indexed by their first byte
+//	param:    one segment (up to the next '/') passing the constraint if any,
+//	          path is the param name
+//	catchAll: the rest of the request path, path is the param name
+//
+// Lookup prefers static children, then params, then the catch-all,
+// and backtracks when a branch does not lead to a route.
+type node struct {
+	path     string
+	indices  string
+	children []*node
+	params   []*node
+	catchAll *node
+	route    *Router
+
+	// only for param
+	constraint string
+	match      ParamTypeFunc
+}
+
+func (this *node) addRoute(path string, route *Router) error {
+	if path == "" {
+		if this.route != nil {
+			return fmt.Errorf("route conflict with %s", this.route.realPath)
+		}
+		this.route = route
+		return nil
+	}
+	switch path[0] {
+	case ':':
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		name, constraint, match, err := parseParam(path[1:end])
+		if err != nil {
+			return err
+		}
+		for _, param := range this.params {
+			if param.path == name && param.constraint == constraint {
+				return param.addRoute(path[end:], route)
+			}
+		}
+		param := &node{path: name, constraint: constraint, match: match}
+		if err := param.addRoute(path[end:], route); err != nil {
+			return err
+		}
+		// constrained params are tried before the unconstrained ones
+		i := len(this.params)
+		if match != nil {
+			for i > 0 && this.params[i-1].match == nil {
+				i--
+			}
+		}
+		this.params = append(this.params, nil)
+		copy(this.params[i+1:], this.params[i:])
+		this.params[i] = param
+		return nil
+	case '*':
+		name := path[1:]
+		if name == "" || strings.ContainsAny(name, ":*/") {
+			return fmt.Errorf("catch-all %q should be the last segment", path)
+		}
+		if this.catchAll != nil {
+			return fmt.Errorf("catch-all conflict with %s", this.catchAll.route.realPath)
+		}
+		this.catchAll = &node{path: name, route: route}
+		return nil
+	}
+	end := strings.IndexAny(path, ":*")
+	if end < 0 {
+		end = len(path)
+	} else if path[end-1] != '/' {
+		return fmt.Errorf("wildcard should follow a '/' in %q", path)
+	}
+	child := this.child(path[0])
+	if child == nil {
+		child = &node{path: path[:end]}
+		if err := child.addRoute(path[end:], route); err != nil {
+			return err
+		}
+		this.indices += path[:1]
+		this.children = append(this.children, child)
+		return nil
+	}
+	i := commonPrefix(path[:end], child.path)
+	if i < len(child.path) {
+		// split the child at the common prefix
+		suffix := &node{
+			path:     child.path[i:],
+			indices:  child.indices,
+			children: child.children,
+			params:   child.params,
+			catchAll: child.catchAll,
+			route:    child.route,
+		}
+		*child = node{
+			path:     child.path[:i],
+			indices:  suffix.path[:1],
+			children: []*node{suffix},
+		}
+	}
+	return child.addRoute(path[i:], route)
+}
+
+func (this *node) child(c byte) *node {
+	if i := strings.IndexByte(this.indices, c); i >= 0 {
+		return this.children[i]
+	}
+	return nil
+}
+
+// lookup matches path against the subtree below this node,
+// this node's own path is already consumed.
+func (this *node) lookup(path string, params *Params) *Router {
+	if path == "" && this.route != nil {
+		return this.route
+	}
+	if path != "" {
+		if child := this.child(path[0]); child != nil && strings.HasPrefix(path, child.path) {
+			if route := child.lookup(path[len(child.path):], params); route != nil {
+				return route
+			}
+		}
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			for _, param := range this.params {
+				if param.match != nil && !param.match(path[:end]) {
+					continue
+				}
+				*params = append(*params, Param{param.path, path[:end]})
+				if route := param.lookup(path[end:], params); route != nil {
+					return route
+				}
+				*params = (*params)[:len(*params)-1]
+			}
+		}
+	}
+	if this.catchAll != nil {
+		*params = append(*params, Param{this.catchAll.path, path})
+		return this.catchAll.route
+	}
+	return nil
+}
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
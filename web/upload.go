@@ -0,0 +1,323 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	_UPLOAD_OPTIONS_META_KEY = "upload_options"
+	_UPLOAD_FORM_META_KEY    = "upload_form"
+
+	// file parts over it are written to temp files
+	_DEFAULT_UPLOAD_MAX_MEMORY = 1 << 20
+	_SNIFF_LEN                 = 512
+)
+
+type UploadOptions struct {
+	MaxBodyBytes int64 // max size of the whole request body, 0 means no limit, the limit of router (default 10MB) applies first
+	MaxFileBytes int64 // max size of each file, 0 means no limit
+	MaxMemory    int64 // file parts over it are written to temp files, 0 means 1MB
+	// mime types sniffed from file content, like "image/png" or "image/*",
+	// empty means any type
+	AllowedTypes []string
+}
+
+// UploadError is returned when an upload is oversized or disallowed,
+// HttpStatus is 413 or 415.
+type UploadError struct {
+	HttpStatus int
+	Message    string
+}
+
+func (this *UploadError) Error() string {
+	return this.Message
+}
+
+type uploadForm struct {
+	form *multipart.Form
+	// size of the body read, -1 if it is unknown
+	size int64
+	err  error
+}
+
+// Upload sets the upload options of a router and parses the multipart form,
+// a bad upload is responded by ErrorWithHttpStatus with 400, 413 or 415.
+// If the form is parsed by middleware before it, such as CSRF, the body is read with the limit of router only,
+// the upload options are checked after that. Set Router.MaxBodyBytes to limit the body before any read.
+//
+//	server.POST("/avatar", web.Upload(web.UploadOptions{
+//		MaxFileBytes: 2 << 20,
+//		AllowedTypes: []string{"image/*"},
+//	}), avatarHandler)
+func Upload(opts UploadOptions) HandlerFunc {
+	return func(c *Context) {
+		c.metaInternal.Store(_UPLOAD_OPTIONS_META_KEY, &opts)
+		var err error
+		if parsed, ok := c.metaInternal.Load(_UPLOAD_FORM_META_KEY); ok {
+			err = parsed.(*uploadForm).err
+			if err == nil {
+				err = checkParsedForm(parsed.(*uploadForm), &opts)
+			}
+		} else {
+			_, err = c.MultipartForm()
+		}
+		if err != nil {
+			status := 400
+			if uerr, ok := err.(*UploadError); ok {
+				status = uerr.HttpStatus
+			}
+			log.Debug("upload rejected", status, err)
+			c.ErrorWithHttpStatus(status, status, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// MultipartForm parses the multipart form once and checks the upload options
+func (this *Context) MultipartForm() (*multipart.Form, error) {
+	if parsed, ok := this.metaInternal.Load(_UPLOAD_FORM_META_KEY); ok {
+		return parsed.(*uploadForm).form, parsed.(*uploadForm).err
+	}
+	parsed := this.parseMultipartForm()
+	this.metaInternal.Store(_UPLOAD_FORM_META_KEY, parsed)
+	return parsed.form, parsed.err
+}
+
+// removeMultipartForm removes the temp files of the form parsed by MultipartForm,
+// net/http removes them only if the form is set on the original request,
+// but c.Request may be replaced by middleware such as RequestId.
+func (this *Context) removeMultipartForm() {
+	if parsed, ok := this.metaInternal.Load(_UPLOAD_FORM_META_KEY); ok && parsed.(*uploadForm).form != nil {
+		if err := parsed.(*uploadForm).form.RemoveAll(); err != nil {
+			log.Warn("remove upload temp files faild", err)
+		}
+	}
+}
+
+func (this *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	form, err := this.MultipartForm()
+	if err != nil {
+		return nil, err
+	}
+	if files := form.File[name]; len(files) > 0 {
+		return files[0], nil
+	}
+	return nil, http.ErrMissingFile
+}
+
+// SaveUploadedFile copies the file to dst by stream, the parent dirs are created
+func (this *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (this *Context) uploadOptions() *UploadOptions {
+	if opts, ok := this.metaInternal.Load(_UPLOAD_OPTIONS_META_KEY); ok {
+		return opts.(*UploadOptions)
+	}
+	return &UploadOptions{}
+}
+
+// parseMultipartForm streams the parts, so an oversized or disallowed file is rejected
+// when it is read, before the rest of the body is read or written to temp files.
+func (this *Context) parseMultipartForm() *uploadForm {
+	opts := this.uploadOptions()
+	if form := this.Request.MultipartForm; form != nil {
+		// parsed by Request.ParseMultipartForm, the size of body is unknown
+		parsed := &uploadForm{form: form, size: -1}
+		parsed.err = checkParsedForm(parsed, opts)
+		return parsed
+	}
+	_, params, err := mime.ParseMediaType(this.Request.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return &uploadForm{err: http.ErrNotMultipart}
+	}
+	if opts.MaxBodyBytes > 0 {
+		this.Request.Body = http.MaxBytesReader(this.rawResponseWriter(), this.Request.Body, opts.MaxBodyBytes)
+	}
+	maxMemory := opts.MaxMemory
+	if maxMemory <= 0 {
+		maxMemory = _DEFAULT_UPLOAD_MAX_MEMORY
+	}
+
+	// the parts checked are written to a pipe, which is read by ReadForm
+	body := &countingReader{Reader: this.Request.Body}
+	reader := multipart.NewReader(body, params["boundary"])
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(copyParts(reader, writer, opts))
+	}()
+	form, err := multipart.NewReader(pr, writer.Boundary()).ReadForm(maxMemory)
+	// stops copying if ReadForm returns early
+	pr.Close()
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		var uploadError *UploadError
+		if errors.As(err, &uploadError) {
+			return &uploadForm{err: uploadError}
+		}
+		if errors.As(err, &maxBytesError) {
+			return &uploadForm{err: &UploadError{413, fmt.Sprintf("request body is larger than %d bytes", opts.MaxBodyBytes)}}
+		}
+		return &uploadForm{err: err}
+	}
+
+	this.Request.MultipartForm = form
+	if err := this.Request.ParseForm(); err != nil {
+		return &uploadForm{err: err}
+	}
+	for key, values := range form.Value {
+		this.Request.PostForm[key] = append(this.Request.PostForm[key], values...)
+		this.Request.Form[key] = append(this.Request.Form[key], values...)
+	}
+	return &uploadForm{form: form, size: body.n}
+}
+
+// copyParts copies the parts of reader to writer, and checks the files by upload options
+func copyParts(reader *multipart.Reader, writer *multipart.Writer, opts *UploadOptions) error {
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return writer.Close()
+		}
+		if err != nil {
+			return err
+		}
+		dst, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		if part.FileName() == "" {
+			if _, err := io.Copy(dst, part); err != nil {
+				return err
+			}
+			continue
+		}
+
+		head := make([]byte, _SNIFF_LEN)
+		n, err := io.ReadFull(part, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return err
+		}
+		if len(opts.AllowedTypes) > 0 {
+			if mimeType := sniffContent(head[:n]); !mimeAllowed(mimeType, opts.AllowedTypes) {
+				return &UploadError{415, fmt.Sprintf(
+					"file %s of %s has disallowed type %s", part.FileName(), part.FormName(), mimeType)}
+			}
+		}
+		if _, err := dst.Write(head[:n]); err != nil {
+			return err
+		}
+		src := io.Reader(part)
+		if opts.MaxFileBytes > 0 {
+			// one more byte to know it is over the limit
+			src = io.LimitReader(part, opts.MaxFileBytes-int64(n)+1)
+		}
+		copied, err := io.Copy(dst, src)
+		if err != nil {
+			return err
+		}
+		if opts.MaxFileBytes > 0 && int64(n)+copied > opts.MaxFileBytes {
+			return &UploadError{413, fmt.Sprintf(
+				"file %s of %s is larger than %d bytes", part.FileName(), part.FormName(), opts.MaxFileBytes)}
+		}
+	}
+}
+
+// checkParsedForm checks a form parsed before the upload options are set
+func checkParsedForm(parsed *uploadForm, opts *UploadOptions) error {
+	if opts.MaxBodyBytes > 0 && parsed.size > opts.MaxBodyBytes {
+		return &UploadError{413, fmt.Sprintf("request body is larger than %d bytes", opts.MaxBodyBytes)}
+	}
+	for name, files := range parsed.form.File {
+		for _, file := range files {
+			if opts.MaxFileBytes > 0 && file.Size > opts.MaxFileBytes {
+				return &UploadError{413, fmt.Sprintf(
+					"file %s of %s is larger than %d bytes", file.Filename, name, opts.MaxFileBytes)}
+			}
+			if len(opts.AllowedTypes) < 1 {
+				continue
+			}
+			mimeType, err := sniffFile(file)
+			if err != nil {
+				return err
+			}
+			if !mimeAllowed(mimeType, opts.AllowedTypes) {
+				return &UploadError{415, fmt.Sprintf(
+					"file %s of %s has disallowed type %s", file.Filename, name, mimeType)}
+			}
+		}
+	}
+	return nil
+}
+
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (this *countingReader) Read(p []byte) (int, error) {
+	n, err := this.Reader.Read(p)
+	this.n += int64(n)
+	return n, err
+}
+
+func sniffFile(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, _SNIFF_LEN)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return sniffContent(buf[:n]), nil
+}
+
+func sniffContent(head []byte) string {
+	mimeType := http.DetectContentType(head)
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return mimeType
+}
+
+func mimeAllowed(mimeType string, allowedTypes []string) bool {
+	for _, allowed := range allowedTypes {
+		if allowed == mimeType || allowed == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mimeType, allowed[:len(allowed)-1]) {
+			return true
+		}
+	}
+	return false
+}
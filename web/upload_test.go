@@ -0,0 +1,220 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\x0D\x0A\x1A\x0A")
+
+func postFile(t *testing.T, url string, content []byte) (int, string) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	w.WriteField("name", "avatar")
+	part, _ := w.CreateFormFile("file", "avatar.png")
+	part.Write(content)
+	w.Close()
+	res, err := http.Post(url, w.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	resp, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(resp)
+}
+
+func TestUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kelp-web-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := New("")
+	s.POST("/upload", Upload(UploadOptions{
+		MaxBodyBytes: 4096,
+		MaxFileBytes: 1024,
+		MaxMemory:    16,
+		AllowedTypes: []string{"image/*"},
+	}), func(c *Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.Error(1, err)
+			return
+		}
+		if err := c.SaveUploadedFile(file, filepath.Join(dir, "sub", file.Filename)); err != nil {
+			c.Error(1, err)
+			return
+		}
+		c.Success(c.Request.FormValue("name"))
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	png := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, 100)...)
+	if status, resp := postFile(t, ts.URL+"/upload", png); status != 200 || resp != `{"data":"avatar","status":0}` {
+		t.Error(status, resp)
+	}
+	if saved, _ := ioutil.ReadFile(filepath.Join(dir, "sub", "avatar.png")); !bytes.Equal(saved, png) {
+		t.Error("saved file mismatch")
+	}
+
+	cases := []struct {
+		content []byte
+		status  int
+	}{
+		{append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, 2000)...), 413},
+		{append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, 8000)...), 413},
+		{[]byte("plain text"), 415},
+	}
+	for _, c := range cases {
+		status, resp := postFile(t, ts.URL+"/upload", c.content)
+		if status != c.status || !bytes.HasPrefix([]byte(resp), []byte(`{"message":`)) {
+			t.Error(len(c.content), status, resp)
+		}
+	}
+}
+
+func TestMimeAllowed(t *testing.T) {
+	allowed := []string{"image/*", "application/pdf"}
+	for mimeType, expect := range map[string]bool{
+		"image/png":       true,
+		"application/pdf": true,
+		"text/plain":      false,
+		"imagex/png":      false,
+	} {
+		if mimeAllowed(mimeType, allowed) != expect {
+			t.Error(mimeType, expect)
+		}
+	}
+}
+
+func TestUploadStream(t *testing.T) {
+	s := New("")
+	s.POST("/upload", Upload(UploadOptions{MaxFileBytes: 1024}), func(c *Context) {
+		c.Success("ok")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	// a large file is rejected when its first bytes over the limit are read
+	const total = 64 << 20
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	written := int64(0)
+	go func() {
+		part, _ := w.CreateFormFile("file", "large.bin")
+		chunk := bytes.Repeat([]byte{0}, 32<<10)
+		for atomic.LoadInt64(&written) < total {
+			n, err := part.Write(chunk)
+			atomic.AddInt64(&written, int64(n))
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		w.Close()
+		pw.Close()
+	}()
+	res, err := http.Post(ts.URL+"/upload", w.FormDataContentType(), pr)
+	pr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 413 {
+		t.Error(res.StatusCode)
+	}
+	if atomic.LoadInt64(&written) >= total {
+		t.Error("the whole body is read")
+	}
+}
+
+func TestUploadAfterCSRF(t *testing.T) {
+	s := New("")
+	s.Use(CSRF(CSRFOptions{DoubleSubmit: true}))
+	s.POST("/upload", Upload(UploadOptions{MaxFileBytes: 1024, AllowedTypes: []string{"image/*"}}), func(c *Context) {
+		c.Success(c.Request.FormValue("name"))
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	png := append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, 100)...)
+	cases := []struct {
+		content []byte
+		status  int
+	}{
+		{png, 200},
+		// checked after the form is parsed by CSRF
+		{append(append([]byte{}, pngHeader...), bytes.Repeat([]byte{0}, 2000)...), 413},
+		{[]byte("plain text"), 415},
+	}
+	for _, c := range cases {
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		w.WriteField("_csrf", "token")
+		w.WriteField("name", "avatar")
+		part, _ := w.CreateFormFile("file", "avatar.png")
+		part.Write(c.content)
+		w.Close()
+		req, _ := http.NewRequest("POST", ts.URL+"/upload", body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "token"})
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != c.status || c.status == 200 && string(resp) != `{"data":"avatar","status":0}` {
+			t.Error(len(c.content), res.StatusCode, string(resp))
+		}
+	}
+}
+
+func TestUploadTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	s := New("")
+	s.Use(RequestId())
+	s.POST("/upload", Upload(UploadOptions{MaxMemory: 1}), func(c *Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+			t.Error("file is not stored on disk", file.Size, len(files))
+		}
+		c.Text("ok")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		part, _ := w.CreateFormFile("file", "data.bin")
+		part.Write(bytes.Repeat([]byte{1}, 1<<20))
+		w.Close()
+		res, err := http.Post(ts.URL+"/upload", w.FormDataContentType(), body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 200 {
+			t.Error(res.StatusCode)
+		}
+	}
+	// removed though c.Request is replaced by RequestId
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Error("temp files left", len(files))
+	}
+}
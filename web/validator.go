@@ -163,7 +163,11 @@ func valid(dest reflect.Value, root reflect.Value) error {
 }
 
 func (this *Context) Bind(dest interface{}) error {
-	return Bind(this.Body, dest)
+	body, err := this.RawBody()
+	if err != nil {
+		return err
+	}
+	return Bind(body, dest)
 }
 
 func Bind(data []byte, dest interface{}) error {
@@ -0,0 +1,492 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const _WS_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// message types of websocket frames
+const (
+	WSText   = 1
+	WSBinary = 2
+
+	_WS_CONTINUATION = 0
+	_WS_CLOSE        = 8
+	_WS_PING         = 9
+	_WS_PONG         = 10
+)
+
+// close codes, see RFC 6455 7.4.1
+const (
+	WSCloseNormal          = 1000
+	WSCloseGoingAway       = 1001
+	WSCloseProtocolError   = 1002
+	WSCloseUnsupportedData = 1003
+	WSCloseNoStatus        = 1005
+	WSCloseAbnormal        = 1006
+	WSCloseInvalidPayload  = 1007
+	WSClosePolicyViolation = 1008
+	WSCloseMessageTooBig   = 1009
+	WSCloseInternalError   = 1011
+)
+
+const (
+	_WS_DEFAULT_MAX_MESSAGE_BYTES = 1 << 20
+	_WS_DEFAULT_PING_INTERVAL     = 30 * time.Second
+	_WS_DEFAULT_PONG_TIMEOUT      = 10 * time.Second
+	_WS_WRITE_TIMEOUT             = 10 * time.Second
+)
+
+type WSHandler func(c *Context, conn *WSConn)
+
+type WSOptions struct {
+	// MaxMessageBytes is the max size of a message after joining the fragments,
+	// the connection is closed with 1009 if it is exceeded. 0 means 1MB.
+	MaxMessageBytes int64
+	// AllowedOrigins are the origins like "https://example.com" allowed to connect,
+	// "*" allows every origin.
+	// Only the same origin as Host is allowed if both AllowedOrigins and CheckOrigin are empty.
+	AllowedOrigins []string
+	CheckOrigin    func(r *http.Request) bool
+	// a ping is sent every PingInterval, and the connection is closed
+	// if nothing is received in PingInterval + PongTimeout. 0 means 30s and 10s.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// Subprotocols are chosen in order of the client's Sec-WebSocket-Protocol
+	Subprotocols []string
+}
+
+// WSCloseError is returned by ReadMessage after the connection is closed
+type WSCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (this *WSCloseError) Error() string {
+	return fmt.Sprintf("websocket closed %d %s", this.Code, this.Reason)
+}
+
+type WSConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	options WSOptions
+
+	Subprotocol string
+
+	writeMux sync.Mutex
+	closeMux sync.Mutex
+	closed   bool
+	done     chan struct{}
+}
+
+// WS registers a websocket router with GET method,
+// middleware of the router runs before the upgrade, so session and auth are usable in handler.
+//
+//	server.WS("/chat", func(c *web.Context, conn *web.WSConn) {
+//		for {
+//			messageType, data, err := conn.ReadMessage()
+//			if err != nil {
+//				return
+//			}
+//			conn.WriteMessage(messageType, data)
+//		}
+//	}, web.WSOptions{AllowedOrigins: []string{"https://example.com"}})
+func (this *Router) WS(path string, handler WSHandler, opts ...WSOptions) *Router {
+	options := WSOptions{}
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+	return this.handle(http.MethodGet, path, func(c *Context) {
+		conn, err := c.Upgrade(options)
+		if err != nil {
+			log.Debug("websocket upgrade faild", c.Path(), err)
+			return
+		}
+		defer conn.Close(WSCloseNormal, "")
+		handler(c, conn)
+	})
+}
+
+func (this *Server) WS(path string, handler WSHandler, opts ...WSOptions) *Router {
+	return this.router.WS(path, handler, opts...)
+}
+
+// Upgrade switches the request to websocket,
+// it responds 400, 403 or 426 and returns the error if the handshake is invalid.
+func (this *Context) Upgrade(options WSOptions) (*WSConn, error) {
+	req := this.Request
+	if req.Method != http.MethodGet ||
+		!headerContainsToken(req.Header, "Connection", "upgrade") ||
+		!headerContainsToken(req.Header, "Upgrade", "websocket") {
+		this.DieWithHttpStatus(400)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if req.Header.Get("Sec-Websocket-Version") != "13" {
+		this.ResponseWriter.Header().Set("Sec-WebSocket-Version", "13")
+		this.DieWithHttpStatus(426)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := req.Header.Get("Sec-Websocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		this.DieWithHttpStatus(400)
+		return nil, errors.New("invalid Sec-WebSocket-Key")
+	}
+	if !checkOrigin(req, options) {
+		this.DieWithHttpStatus(403)
+		return nil, fmt.Errorf("origin %s not allowed", req.Header.Get("Origin"))
+	}
+	hijacker, ok := this.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, this.renderFailed("websocket", errors.New("response writer does not support hijack"))
+	}
+	subprotocol := chooseSubprotocol(req, options.Subprotocols)
+
+	// headers set by middleware, such as Set-Cookie and X-Request-Id, are sent in the handshake
+	header := this.ResponseWriter.Header().Clone()
+	for _, key := range []string{"Content-Length", "Content-Type", "Transfer-Encoding"} {
+		header.Del(key)
+	}
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", wsAcceptKey(key))
+	if subprotocol != "" {
+		header.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	handshake := &bytes.Buffer{}
+	handshake.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	header.Write(handshake)
+	handshake.WriteString("\r\n")
+	conn.SetDeadline(time.Time{})
+	conn.SetWriteDeadline(time.Now().Add(_WS_WRITE_TIMEOUT))
+	if _, err := conn.Write(handshake.Bytes()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	this.HttpStatus = http.StatusSwitchingProtocols
+
+	if options.MaxMessageBytes <= 0 {
+		options.MaxMessageBytes = _WS_DEFAULT_MAX_MESSAGE_BYTES
+	}
+	if options.PingInterval <= 0 {
+		options.PingInterval = _WS_DEFAULT_PING_INTERVAL
+	}
+	if options.PongTimeout <= 0 {
+		options.PongTimeout = _WS_DEFAULT_PONG_TIMEOUT
+	}
+	ws := &WSConn{
+		conn:        conn,
+		reader:      rw.Reader,
+		options:     options,
+		Subprotocol: subprotocol,
+		done:        make(chan struct{}),
+	}
+	ws.extendReadDeadline()
+	go ws.keepAlive()
+	return ws, nil
+}
+
+// ReadMessage returns the next text or binary message,
+// ping and pong are handled inside, a *WSCloseError is returned after the peer closed.
+func (this *WSConn) ReadMessage() (int, []byte, error) {
+	messageType := 0
+	message := []byte{}
+	for {
+		fin, opcode, payload, err := this.readFrame()
+		if err != nil {
+			return 0, nil, this.fail(err)
+		}
+		this.extendReadDeadline()
+		switch opcode {
+		case _WS_PING:
+			if err := this.writeFrame(_WS_PONG, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case _WS_PONG:
+			continue
+		case _WS_CLOSE:
+			return 0, nil, this.closeByPeer(payload)
+		case WSText, WSBinary:
+			if messageType != 0 {
+				return 0, nil, this.fail(&WSCloseError{WSCloseProtocolError, "expect continuation frame"})
+			}
+			messageType = opcode
+		case _WS_CONTINUATION:
+			if messageType == 0 {
+				return 0, nil, this.fail(&WSCloseError{WSCloseProtocolError, "unexpected continuation frame"})
+			}
+		default:
+			return 0, nil, this.fail(&WSCloseError{WSCloseProtocolError, "unknown opcode"})
+		}
+		if int64(len(message)+len(payload)) > this.options.MaxMessageBytes {
+			return 0, nil, this.fail(&WSCloseError{WSCloseMessageTooBig, "message too big"})
+		}
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+		if messageType == WSText && !utf8.Valid(message) {
+			return 0, nil, this.fail(&WSCloseError{WSCloseInvalidPayload, "invalid utf-8"})
+		}
+		return messageType, message, nil
+	}
+}
+
+func (this *WSConn) ReadJSON(dest interface{}) error {
+	_, data, err := this.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
+// WriteMessage sends data as a single frame, it is safe for concurrent use
+func (this *WSConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != WSText && messageType != WSBinary {
+		return fmt.Errorf("invalid message type %d", messageType)
+	}
+	return this.writeFrame(messageType, data)
+}
+
+func (this *WSConn) WriteText(text string) error {
+	return this.WriteMessage(WSText, []byte(text))
+}
+
+func (this *WSConn) WriteJSON(data interface{}) error {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return this.WriteMessage(WSText, out)
+}
+
+func (this *WSConn) Ping(data []byte) error {
+	return this.writeFrame(_WS_PING, data)
+}
+
+// Close sends a close frame with code and reason, then closes the connection.
+// It is fine to call Close more than once.
+func (this *WSConn) Close(code int, reason string) error {
+	this.closeMux.Lock()
+	defer this.closeMux.Unlock()
+	if this.closed {
+		return nil
+	}
+	this.closed = true
+	close(this.done)
+	// 1006 means the connection is broken, no close frame is sent
+	if code == WSCloseAbnormal {
+		return this.conn.Close()
+	}
+	payload := []byte{}
+	if code != WSCloseNoStatus {
+		payload = make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+	}
+	this.writeFrame(_WS_CLOSE, payload)
+	return this.conn.Close()
+}
+
+// Done is closed after the connection is closed
+func (this *WSConn) Done() <-chan struct{} {
+	return this.done
+}
+
+func (this *WSConn) RemoteAddr() net.Addr {
+	return this.conn.RemoteAddr()
+}
+
+func (this *WSConn) keepAlive() {
+	ticker := time.NewTicker(this.options.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-this.done:
+			return
+		case <-ticker.C:
+			if err := this.Ping(nil); err != nil {
+				this.Close(WSCloseAbnormal, "")
+				return
+			}
+		}
+	}
+}
+
+func (this *WSConn) extendReadDeadline() {
+	this.conn.SetReadDeadline(time.Now().Add(this.options.PingInterval + this.options.PongTimeout))
+}
+
+// closeByPeer replies the close frame of peer
+func (this *WSConn) closeByPeer(payload []byte) error {
+	closeErr := &WSCloseError{Code: WSCloseNoStatus}
+	if len(payload) == 1 {
+		closeErr = &WSCloseError{WSCloseProtocolError, "invalid close frame"}
+	} else if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+	}
+	this.Close(closeErr.Code, "")
+	return closeErr
+}
+
+// fail closes the connection with the code of err, or 1006 if it is a network error
+func (this *WSConn) fail(err error) error {
+	if closeErr, ok := err.(*WSCloseError); ok {
+		this.Close(closeErr.Code, closeErr.Reason)
+		return err
+	}
+	this.closeMux.Lock()
+	closed := this.closed
+	this.closeMux.Unlock()
+	if closed {
+		return &WSCloseError{Code: WSCloseAbnormal, Reason: err.Error()}
+	}
+	this.Close(WSCloseAbnormal, "")
+	return err
+}
+
+func (this *WSConn) readFrame() (bool, int, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(this.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := int(header[0] & 0x0f)
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &WSCloseError{WSCloseProtocolError, "reserved bits are set"}
+	}
+	// frames from client must be masked
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, &WSCloseError{WSCloseProtocolError, "frame is not masked"}
+	}
+	length := int64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(this.reader, buf); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(buf))
+	case 127:
+		buf := make([]byte, 8)
+		if _, err := io.ReadFull(this.reader, buf); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(buf))
+	}
+	if opcode >= _WS_CLOSE && (length > 125 || !fin) {
+		return false, 0, nil, &WSCloseError{WSCloseProtocolError, "invalid control frame"}
+	}
+	if length < 0 || length > this.options.MaxMessageBytes {
+		return false, 0, nil, &WSCloseError{WSCloseMessageTooBig, "message too big"}
+	}
+	mask := make([]byte, 4)
+	if _, err := io.ReadFull(this.reader, mask); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(this.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+func (this *WSConn) writeFrame(opcode int, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|byte(opcode))
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+	frame = append(frame, payload...)
+	this.writeMux.Lock()
+	defer this.writeMux.Unlock()
+	this.conn.SetWriteDeadline(time.Now().Add(_WS_WRITE_TIMEOUT))
+	_, err := this.conn.Write(frame)
+	return err
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + _WS_GUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func checkOrigin(req *http.Request, options WSOptions) bool {
+	origin := req.Header.Get("Origin")
+	if options.CheckOrigin != nil {
+		return options.CheckOrigin(req)
+	}
+	// not a browser
+	if origin == "" {
+		return true
+	}
+	if len(options.AllowedOrigins) > 0 {
+		for _, allowed := range options.AllowedOrigins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+func chooseSubprotocol(req *http.Request, subprotocols []string) string {
+	for _, value := range req.Header.Values("Sec-Websocket-Protocol") {
+		for _, p := range strings.Split(value, ",") {
+			p = strings.TrimSpace(p)
+			for _, s := range subprotocols {
+				if p == s {
+					return p
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,192 @@
+package web
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type wsTestClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialWS(t *testing.T, addr, path string, header map[string]string) (*wsTestClient, *http.Response) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := "GET " + path + " HTTP/1.1\r\nHost: " + addr + "\r\n" +
+		"Connection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"
+	if _, ok := header["Sec-WebSocket-Version"]; !ok {
+		req += "Sec-WebSocket-Version: 13\r\n"
+	}
+	for k, v := range header {
+		req += k + ": " + v + "\r\n"
+	}
+	conn.Write([]byte(req + "\r\n"))
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wsTestClient{conn, reader}, res
+}
+
+func (this *wsTestClient) write(fin bool, opcode byte, payload []byte) {
+	b0 := opcode
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	if len(payload) <= 125 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, byte(len(payload)>>8), byte(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	this.conn.Write(frame)
+}
+
+func (this *wsTestClient) read(t *testing.T) (int, []byte) {
+	this.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(this.reader, header); err != nil {
+		t.Fatal(err)
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		buf := make([]byte, 2)
+		io.ReadFull(this.reader, buf)
+		length = int(binary.BigEndian.Uint16(buf))
+	}
+	payload := make([]byte, length)
+	io.ReadFull(this.reader, payload)
+	return int(header[0] & 0x0f), payload
+}
+
+func TestWebSocket(t *testing.T) {
+	s := New("")
+	s.Use(func(c *Context) {
+		c.Set("user", "kelp")
+		c.Next()
+	})
+	s.WS("/ws", func(c *Context, conn *WSConn) {
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, append([]byte(c.GetString("user")+":"), data...))
+		}
+	}, WSOptions{MaxMessageBytes: 16, AllowedOrigins: []string{"https://example.com"}, Subprotocols: []string{"chat"}})
+	ts := s.RunTest()
+	defer ts.Close()
+	addr := strings.TrimPrefix(ts.URL, "http://")
+
+	client, res := dialWS(t, addr, "/ws", map[string]string{"Origin": "https://example.com", "Sec-WebSocket-Protocol": "other, chat"})
+	if res.StatusCode != 101 || res.Header.Get("Sec-Websocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" || res.Header.Get("Sec-Websocket-Protocol") != "chat" {
+		t.Fatal(res.StatusCode, res.Header)
+	}
+	client.write(true, WSText, []byte("hello"))
+	if opcode, data := client.read(t); opcode != WSText || string(data) != "kelp:hello" {
+		t.Error(opcode, string(data))
+	}
+	// fragmented binary message
+	client.write(false, WSBinary, []byte("ab"))
+	client.write(true, _WS_PING, []byte("p"))
+	if opcode, data := client.read(t); opcode != _WS_PONG || string(data) != "p" {
+		t.Error(opcode, string(data))
+	}
+	client.write(true, _WS_CONTINUATION, []byte("cd"))
+	if opcode, data := client.read(t); opcode != WSBinary || string(data) != "kelp:abcd" {
+		t.Error(opcode, string(data))
+	}
+	client.write(true, WSText, []byte(strings.Repeat("x", 17)))
+	if opcode, data := client.read(t); opcode != _WS_CLOSE || binary.BigEndian.Uint16(data) != WSCloseMessageTooBig {
+		t.Error(opcode, data)
+	}
+	client.conn.Close()
+
+	client, _ = dialWS(t, addr, "/ws", nil)
+	client.write(true, _WS_CLOSE, []byte{0x03, 0xe8})
+	if opcode, data := client.read(t); opcode != _WS_CLOSE || binary.BigEndian.Uint16(data) != WSCloseNormal {
+		t.Error(opcode, data)
+	}
+	client.conn.Close()
+
+	for header, status := range map[string]int{
+		"Origin":                403,
+		"Sec-WebSocket-Version": 426,
+	} {
+		value := "https://evil.com"
+		if header == "Sec-WebSocket-Version" {
+			value = "8"
+		}
+		client, res := dialWS(t, addr, "/ws", map[string]string{header: value})
+		if res.StatusCode != status {
+			t.Error(header, res.StatusCode)
+		}
+		client.conn.Close()
+	}
+}
+
+func TestWebSocketPing(t *testing.T) {
+	s := New("")
+	closed := make(chan struct{})
+	s.WS("/ws", func(c *Context, conn *WSConn) {
+		conn.ReadMessage()
+		close(closed)
+	}, WSOptions{PingInterval: 50 * time.Millisecond, PongTimeout: 50 * time.Millisecond})
+	ts := s.RunTest()
+	defer ts.Close()
+
+	client, _ := dialWS(t, strings.TrimPrefix(ts.URL, "http://"), "/ws", nil)
+	defer client.conn.Close()
+	if opcode, _ := client.read(t); opcode != _WS_PING {
+		t.Error(opcode)
+	}
+	// no pong, the server should give up
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Error("connection is not closed without pong")
+	}
+}
+
+func TestWebSocketHeaders(t *testing.T) {
+	s := New("")
+	s.UseMemSession(time.Minute, time.Minute)
+	s.Use(RequestId())
+	s.Use(SessionWithCookieHandler("sid", time.Minute))
+	s.WS("/ws", func(c *Context, conn *WSConn) {
+		c.SetSession("user", "kelp")
+		conn.WriteText("hi")
+	})
+	ts := s.RunTest()
+	defer ts.Close()
+	addr := strings.TrimPrefix(ts.URL, "http://")
+
+	client, res := dialWS(t, addr, "/ws", map[string]string{"X-Request-Id": "ws-1"})
+	defer client.conn.Close()
+	if res.StatusCode != 101 || res.Header.Get("X-Request-Id") != "ws-1" || res.Header.Get("Upgrade") != "websocket" {
+		t.Fatal(res.StatusCode, res.Header)
+	}
+	cookies := res.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "sid" || cookies[0].Value == "" {
+		t.Fatal(cookies)
+	}
+	if opcode, data := client.read(t); opcode != WSText || string(data) != "hi" {
+		t.Error(opcode, string(data))
+	}
+}